@@ -11,6 +11,7 @@ import (
 )
 
 var cfgFile string
+var offline bool
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -23,6 +24,9 @@ var rootCmd = &cobra.Command{
 		if err := viper.Unmarshal(&config); err != nil {
 			log.Fatal(err)
 		}
+		if offline {
+			config.Bookmark.Offline = true
+		}
 		api := pkg.NewAPI()
 		files := pkg.NewFiles(config)
 		tm := pkg.New()
@@ -48,6 +52,7 @@ func init() {
 	cobra.OnInitialize(initConfig)
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is notion-site.yaml)")
+	rootCmd.PersistentFlags().BoolVar(&offline, "offline", false, "render bookmarks from the cache only, without fetching them")
 }
 
 // initConfig reads in config file and ENV variables if set.
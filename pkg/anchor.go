@@ -0,0 +1,160 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/dstotijn/go-notion"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// regexCustomAnchor matches a trailing `{#custom-id}` in a heading text
+var regexCustomAnchor = regexp.MustCompile(`\s*\{#([^{}\s]+)\}\s*$`)
+
+type Anchor struct {
+	ID       string
+	Text     string
+	Level    int
+	RichText []notion.RichText
+}
+
+// Anchors holds the heading anchors of the current page, keyed by block id
+type Anchors struct {
+	list    []*Anchor
+	byBlock map[string]*Anchor
+	used    map[string]int
+}
+
+func NewAnchors() *Anchors {
+	return &Anchors{
+		byBlock: make(map[string]*Anchor),
+		used:    make(map[string]int),
+	}
+}
+
+// Collect walks the blocks tree and computes the anchor of every heading in page order
+func (a *Anchors) Collect(blocks []notion.Block) {
+	for _, block := range blocks {
+		switch b := block.(type) {
+		case *notion.Heading1Block:
+			a.add(b.ID(), 1, b.RichText)
+		case *notion.Heading2Block:
+			a.add(b.ID(), 2, b.RichText)
+		case *notion.Heading3Block:
+			a.add(b.ID(), 3, b.RichText)
+		}
+		a.Collect(blockChildren(block))
+	}
+}
+
+func (a *Anchors) add(blockID string, level int, richText []notion.RichText) {
+	richText, custom := splitCustomAnchor(richText)
+	text := strings.TrimSpace(plainText(richText))
+	id := custom
+	if id == "" {
+		id = AnchorID(text)
+	}
+	anchor := &Anchor{
+		ID:       a.unique(id),
+		Text:     text,
+		Level:    level,
+		RichText: richText,
+	}
+	a.list = append(a.list, anchor)
+	a.byBlock[normalizeID(blockID)] = anchor
+}
+
+// unique de-duplicates the id the same way GitHub does: foo, foo-1, foo-2 ...
+func (a *Anchors) unique(id string) string {
+	candidate := id
+	for {
+		n, ok := a.used[candidate]
+		if !ok {
+			break
+		}
+		a.used[candidate] = n + 1
+		candidate = fmt.Sprintf("%s-%d", id, n+1)
+	}
+	a.used[candidate] = 0
+	return candidate
+}
+
+// Get returns the anchor of a heading block, nil if the block is not a heading
+func (a *Anchors) Get(blockID string) *Anchor {
+	if a == nil {
+		return nil
+	}
+	return a.byBlock[normalizeID(blockID)]
+}
+
+// List returns all anchors in page order
+func (a *Anchors) List() []*Anchor {
+	if a == nil {
+		return nil
+	}
+	return a.list
+}
+
+// AnchorID slugs a heading text into an anchor id. Letters and digits of any
+// script (CJK included) are kept, so the id stays readable for non latin titles.
+func AnchorID(text string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.Is(unicode.Mn, r):
+			if dash && b.Len() > 0 {
+				b.WriteRune('-')
+			}
+			dash = false
+			b.WriteRune(r)
+		case unicode.IsSpace(r) || r == '-' || r == '_':
+			dash = true
+		}
+	}
+	if b.Len() == 0 {
+		return "section"
+	}
+	return b.String()
+}
+
+// splitCustomAnchor strips a trailing `{#custom-id}` from the heading rich text
+func splitCustomAnchor(richText []notion.RichText) ([]notion.RichText, string) {
+	if len(richText) == 0 {
+		return richText, ""
+	}
+	last := richText[len(richText)-1]
+	if last.Type != notion.RichTextTypeText || last.Text == nil {
+		return richText, ""
+	}
+	m := regexCustomAnchor.FindStringSubmatchIndex(last.Text.Content)
+	if m == nil {
+		return richText, ""
+	}
+	custom := last.Text.Content[m[2]:m[3]]
+	text := *last.Text
+	text.Content = last.Text.Content[:m[0]]
+	last.Text = &text
+	last.PlainText = text.Content
+
+	stripped := make([]notion.RichText, len(richText))
+	copy(stripped, richText)
+	stripped[len(stripped)-1] = last
+	if text.Content == "" {
+		stripped = stripped[:len(stripped)-1]
+	}
+	return stripped, custom
+}
+
+func plainText(richText []notion.RichText) string {
+	var b strings.Builder
+	for _, rt := range richText {
+		b.WriteString(rt.PlainText)
+	}
+	return b.String()
+}
+
+// normalizeID strips the dashes so ids from the api and from notion urls compare equal
+func normalizeID(id string) string {
+	return strings.ReplaceAll(strings.ToLower(id), "-", "")
+}
@@ -0,0 +1,84 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+)
+
+func TestAnchorID(t *testing.T) {
+	cases := map[string]string{
+		"Hello World":            "hello-world",
+		"  Go 1.19: what's new?": "go-119-whats-new",
+		"snake_case and-dash":    "snake-case-and-dash",
+		"中文标题":                   "中文标题",
+		"快速 开始 Guide":            "快速-开始-guide",
+		"日本語の見出し":                "日本語の見出し",
+		"한국어 제목":                 "한국어-제목",
+		"Café déjà vu":           "café-déjà-vu",
+		"🚀 !!!":                  "section",
+		"":                       "section",
+	}
+	for text, want := range cases {
+		if got := AnchorID(text); got != want {
+			t.Errorf("%q: got %q, want %q", text, got, want)
+		}
+	}
+}
+
+// TestAnchorsCollect checks the headings of the same text get -1, -2 appended and a {#id} is kept as is
+func TestAnchorsCollect(t *testing.T) {
+	headings := []struct{ id, text, want string }{
+		{"h1", "Intro", "intro"},
+		{"h2", "Intro", "intro-1"},
+		{"h3", "Intro", "intro-2"},
+		{"h4", "Setup {#install}", "install"},
+		{"h5", "Install", "install-1"},
+		{"h6", "intro-1", "intro-1-1"},
+	}
+	var results []string
+	for _, h := range headings {
+		results = append(results, fmt.Sprintf(`{"object":"block","id":%q,"type":"heading_2","heading_2":{"rich_text":[{"type":"text","text":{"content":%q},"plain_text":%q}]}}`, h.id, h.text, h.text))
+	}
+	var resp notion.BlockChildrenResponse
+	if err := json.Unmarshal([]byte(`{"results":[`+strings.Join(results, ",")+`]}`), &resp); err != nil {
+		t.Fatal(err)
+	}
+	anchors := NewAnchors()
+	anchors.Collect(resp.Results)
+	for _, h := range headings {
+		if got := anchors.Get(h.id); got == nil || got.ID != h.want {
+			t.Errorf("%q: got %+v, want %s", h.text, got, h.want)
+		}
+	}
+	if got := anchors.Get("h4").Text; got != "Setup" {
+		t.Errorf("custom anchor left in the text: %q", got)
+	}
+}
+
+func TestSplitCustomAnchor(t *testing.T) {
+	text := func(content string) notion.RichText {
+		return notion.RichText{Type: notion.RichTextTypeText, Text: &notion.Text{Content: content}, PlainText: content}
+	}
+	cases := []struct {
+		rich   []notion.RichText
+		text   string
+		custom string
+	}{
+		{[]notion.RichText{text("Title {#my-id}")}, "Title", "my-id"},
+		{[]notion.RichText{text("Title "), text("{#my-id}  ")}, "Title ", "my-id"},
+		{[]notion.RichText{text("Title {#my id}")}, "Title {#my id}", ""},
+		{[]notion.RichText{text("{#a} Title")}, "{#a} Title", ""},
+		{[]notion.RichText{text("Title")}, "Title", ""},
+		{nil, "", ""},
+	}
+	for _, c := range cases {
+		rich, custom := splitCustomAnchor(c.rich)
+		if got := plainText(rich); got != c.text || custom != c.custom {
+			t.Errorf("%q: got %q %q, want %q %q", plainText(c.rich), got, custom, c.text, c.custom)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package pkg
+
+import (
+	"github.com/dstotijn/go-notion"
+	"strings"
+)
+
+const (
+	calloutTargetHugo       = "hugo"
+	calloutTargetAdmonition = "admonition"
+	calloutTargetGithub     = "github"
+	calloutTargetDocusaurus = "docusaurus"
+	calloutTargetMkdocs     = "mkdocs"
+
+	defaultCalloutType      = "note"
+	defaultCalloutShortcode = "callout"
+)
+
+// calloutTypes maps the callout emojis and background colors to admonition types
+var calloutTypes = map[string]string{
+	"💡":                 "tip",
+	"⚠":                 "warning",
+	"❗":                 "danger",
+	"‼":                 "danger",
+	"🚨":                 "danger",
+	"🔥":                 "important",
+	"ℹ":                 "info",
+	"📝":                 "note",
+	"✅":                 "success",
+	"❓":                 "question",
+	"🐛":                 "bug",
+	"red_background":    "danger",
+	"orange_background": "warning",
+	"yellow_background": "warning",
+	"green_background":  "tip",
+	"blue_background":   "info",
+	"gray_background":   "note",
+}
+
+// githubAlerts are the alert types github knows
+var githubAlerts = map[string]string{
+	"note":      "NOTE",
+	"info":      "NOTE",
+	"tip":       "TIP",
+	"success":   "TIP",
+	"important": "IMPORTANT",
+	"warning":   "WARNING",
+	"danger":    "CAUTION",
+	"bug":       "CAUTION",
+	"caution":   "CAUTION",
+}
+
+// docusaurusAdmonitions are the admonition types docusaurus knows
+var docusaurusAdmonitions = map[string]string{
+	"note":      "note",
+	"tip":       "tip",
+	"success":   "tip",
+	"info":      "info",
+	"important": "info",
+	"warning":   "warning",
+	"caution":   "warning",
+	"danger":    "danger",
+	"bug":       "danger",
+}
+
+// calloutType is the admonition type of a callout, by its emoji then its color
+func calloutType(callout *notion.CalloutBlock, config Callouts) string {
+	var keys []string
+	if callout.Icon != nil && callout.Icon.Emoji != nil {
+		// the emoji variation selector is optional: ⚠️ and ⚠ are the same
+		keys = append(keys, strings.ReplaceAll(*callout.Icon.Emoji, "\ufe0f", ""))
+	}
+	keys = append(keys, string(callout.Color))
+	for _, types := range []map[string]string{config.Types, calloutTypes} {
+		for _, key := range keys {
+			if t, ok := types[key]; ok && t != "" {
+				return t
+			}
+			if t, ok := types[key+"\ufe0f"]; ok && t != "" {
+				return t
+			}
+		}
+	}
+	if config.DefaultType != "" {
+		return config.DefaultType
+	}
+	return defaultCalloutType
+}
+
+// targetCalloutType is the type as the target names it
+func targetCalloutType(t string, target string) string {
+	switch target {
+	case calloutTargetGithub:
+		if alert, ok := githubAlerts[strings.ToLower(t)]; ok {
+			return alert
+		}
+		return githubAlerts[defaultCalloutType]
+	case calloutTargetDocusaurus:
+		if admonition, ok := docusaurusAdmonitions[strings.ToLower(t)]; ok {
+			return admonition
+		}
+		return defaultCalloutType
+	}
+	return t
+}
+
+// calloutBody prefixes the lines of the callout content as the target nests them
+func calloutBody(body string, indent string, target string) string {
+	lines := strings.Split(strings.TrimRight(body, "\n"), "\n")
+	for i, line := range lines {
+		switch target {
+		case calloutTargetGithub:
+			lines[i] = strings.TrimRight(indent+"> "+line, " ")
+		case calloutTargetMkdocs:
+			if line != "" {
+				lines[i] = indent + "    " + line
+			}
+		default:
+			if line != "" {
+				lines[i] = indent + line
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
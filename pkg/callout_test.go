@@ -0,0 +1,59 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// TestCalloutType checks the type is found by the emoji, with or without its variation selector,
+// then by the color, the configured types first
+func TestCalloutType(t *testing.T) {
+	config := Callouts{Types: map[string]string{"🦄": "magic", "purple_background": "important"}, DefaultType: "info"}
+	cases := []struct {
+		emoji string
+		color notion.Color
+		want  string
+	}{
+		{"💡", notion.ColorDefault, "tip"},
+		{"⚠️", notion.ColorDefault, "warning"},
+		{"⚠", notion.ColorDefault, "warning"},
+		{"❗", notion.ColorBlue, "danger"},
+		{"", notion.ColorRedBg, "danger"},
+		{"🎈", notion.ColorGreenBg, "tip"},
+		{"🦄", notion.ColorDefault, "magic"},
+		{"", notion.ColorPurpleBg, "important"},
+		{"🎈", notion.ColorDefault, "info"},
+	}
+	for _, c := range cases {
+		callout := &notion.CalloutBlock{Color: c.color}
+		if c.emoji != "" {
+			emoji := c.emoji
+			callout.Icon = &notion.Icon{Type: notion.IconTypeEmoji, Emoji: &emoji}
+		}
+		if got := calloutType(callout, config); got != c.want {
+			t.Errorf("%q %s: got %s, want %s", c.emoji, c.color, got, c.want)
+		}
+	}
+	if got := calloutType(&notion.CalloutBlock{}, Callouts{}); got != defaultCalloutType {
+		t.Errorf("got %s, want %s", got, defaultCalloutType)
+	}
+}
+
+func TestTargetCalloutType(t *testing.T) {
+	cases := []struct{ calloutType, target, want string }{
+		{"tip", calloutTargetHugo, "tip"},
+		{"magic", calloutTargetAdmonition, "magic"},
+		{"danger", calloutTargetGithub, "CAUTION"},
+		{"success", calloutTargetGithub, "TIP"},
+		{"magic", calloutTargetGithub, "NOTE"},
+		{"important", calloutTargetDocusaurus, "info"},
+		{"magic", calloutTargetDocusaurus, "note"},
+		{"bug", calloutTargetMkdocs, "bug"},
+	}
+	for _, c := range cases {
+		if got := targetCalloutType(c.calloutType, c.target); got != c.want {
+			t.Errorf("%s for %s: got %s, want %s", c.calloutType, c.target, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package pkg
+
+import (
+	"github.com/dstotijn/go-notion"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const codeRenderHighlight = "highlight"
+
+// codeLanguages maps the notion code languages to the chroma and prism names, the others are the same
+var codeLanguages = map[string]string{
+	"plain text":    "text",
+	"c++":           "cpp",
+	"c#":            "csharp",
+	"f#":            "fsharp",
+	"java/c/c++/c#": "java",
+	"objective-c":   "objectivec",
+	"visual basic":  "vbnet",
+	"vb.net":        "vbnet",
+	"shell":         "bash",
+	"docker":        "dockerfile",
+	"markup":        "html",
+	"flow":          "javascript",
+	"reason":        "reasonml",
+	"webassembly":   "wasm",
+}
+
+var (
+	regexCodeHighlight = regexp.MustCompile(`\{([\d\s,-]+)\}`)
+	regexCodeOption    = regexp.MustCompile(`(\w+)=("[^"]*"|\S+)`)
+	regexCodeFilename  = regexp.MustCompile(`^[\w./-]+\.\w+$`)
+)
+
+// codeCaption is what the caption of a code block says about it, e.g. title=main.go {3-5} linenos=table
+type codeCaption struct {
+	Title string
+	// HlLines are the highlighted lines: 3-5 8
+	HlLines string
+	// Options are the other key=value pairs, in order
+	Options [][2]string
+	// Text is what is left of the caption
+	Text string
+}
+
+// codeLanguage maps a notion language to the highlighter name, configured names first
+func codeLanguage(language *string, configured map[string]string) string {
+	if language == nil {
+		return ""
+	}
+	lang := strings.ToLower(*language)
+	if name, ok := configured[lang]; ok {
+		return name
+	}
+	if name, ok := codeLanguages[lang]; ok {
+		return name
+	}
+	return strings.ReplaceAll(lang, " ", "")
+}
+
+// parseCodeCaption extracts the file name, highlighted lines and highlight options of a caption,
+// a caption which is only a file name is the title
+func parseCodeCaption(caption string) codeCaption {
+	var cc codeCaption
+	text := regexCodeHighlight.ReplaceAllStringFunc(caption, func(s string) string {
+		ranges := strings.FieldsFunc(s[1:len(s)-1], func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		cc.HlLines = strings.TrimSpace(cc.HlLines + " " + strings.Join(ranges, " "))
+		return ""
+	})
+	text = regexCodeOption.ReplaceAllStringFunc(text, func(s string) string {
+		kv := regexCodeOption.FindStringSubmatch(s)
+		key, value := strings.ToLower(kv[1]), strings.Trim(kv[2], `"`)
+		switch key {
+		case "title", "file", "filename":
+			cc.Title = value
+		case "hl_lines":
+			cc.HlLines = strings.TrimSpace(cc.HlLines + " " + strings.ReplaceAll(value, ",", " "))
+		default:
+			cc.Options = append(cc.Options, [2]string{key, value})
+		}
+		return ""
+	})
+	text = strings.TrimSpace(text)
+	if cc.Title == "" && regexCodeFilename.MatchString(text) {
+		cc.Title, text = text, ""
+	}
+	cc.Text = text
+	return cc
+}
+
+// attributes renders the options as code fence attributes: title="main.go" hl_lines="3-5"
+func (cc codeCaption) attributes() string {
+	var attrs []string
+	if cc.Title != "" {
+		attrs = append(attrs, "title="+strconv.Quote(cc.Title))
+	}
+	if cc.HlLines != "" {
+		attrs = append(attrs, "hl_lines="+strconv.Quote(cc.HlLines))
+	}
+	for _, option := range cc.Options {
+		attrs = append(attrs, option[0]+"="+codeOptionValue(option[1]))
+	}
+	return strings.Join(attrs, " ")
+}
+
+// highlightOptions renders the options of the highlight shortcode: hl_lines=3-5,linenos=table
+func (cc codeCaption) highlightOptions() string {
+	var opts []string
+	if cc.HlLines != "" {
+		opts = append(opts, "hl_lines="+cc.HlLines)
+	}
+	for _, option := range cc.Options {
+		opts = append(opts, option[0]+"="+option[1])
+	}
+	return strings.Join(opts, ",")
+}
+
+func codeOptionValue(value string) string {
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value
+	}
+	if value == "true" || value == "false" || value == "table" || value == "inline" {
+		return value
+	}
+	return strconv.Quote(value)
+}
+
+// codeFence is a fence longer than the backtick runs of the code
+func codeFence(code []notion.RichText) string {
+	longest, run := 0, 0
+	for _, r := range plainText(code) {
+		if r == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+			continue
+		}
+		run = 0
+	}
+	if longest < 3 {
+		return "```"
+	}
+	return strings.Repeat("`", longest+1)
+}
@@ -0,0 +1,35 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCodeCaption(t *testing.T) {
+	cases := map[string]codeCaption{
+		"main.go":                      {Title: "main.go"},
+		"title=main.go {3-5}":          {Title: "main.go", HlLines: "3-5"},
+		`title="my file.go" {1,3-5 8}`: {Title: "my file.go", HlLines: "1 3-5 8"},
+		"{2} hl_lines=4,6":             {HlLines: "2 4 6"},
+		"file=a.py linenos=table":      {Title: "a.py", Options: [][2]string{{"linenos", "table"}}},
+		"Filename=b.sh lineNoStart=10": {Title: "b.sh", Options: [][2]string{{"linenostart", "10"}}},
+		"An example {2}":               {HlLines: "2", Text: "An example"},
+		"Just a caption":               {Text: "Just a caption"},
+		"":                             {},
+	}
+	for caption, want := range cases {
+		if got := parseCodeCaption(caption); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %+v, want %+v", caption, got, want)
+		}
+	}
+}
+
+func TestCodeCaptionOptions(t *testing.T) {
+	cc := parseCodeCaption(`title=main.go {3-5} linenos=table style="monokai"`)
+	if got, want := cc.attributes(), `title="main.go" hl_lines="3-5" linenos=table style="monokai"`; got != want {
+		t.Errorf("attributes: got %s, want %s", got, want)
+	}
+	if got, want := cc.highlightOptions(), "hl_lines=3-5,linenos=table,style=monokai"; got != want {
+		t.Errorf("highlight options: got %s, want %s", got, want)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/fs"
 	"io/ioutil"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -16,12 +17,199 @@ type Notion struct {
 }
 
 type Markdown struct {
-	HomePath        string `yaml:"homePath"`
+	HomePath string `yaml:"homePath"`
+	// ImagePublicLink is the url the media files are published at apart from the site, e.g. a cdn bucket.
+	// The path of the file in the home path is appended to it, or it is a template of the url:
+	// https://cdn.example.com/{{.Position}}/{{.Slug}}/{{.File}} with Folder, the media folder, too.
+	// The files are still written to the home path to be uploaded. Default is links relative to the page
 	ImagePublicLink string `yaml:"imagePublicLink"`
 
 	// Optional:
-	GroupByMonth bool   `yaml:"groupByMonth,omitempty"`
+	// GroupByMonth puts the pages in a folder of the day they were created, 2006-01-02/<slug>
+	GroupByMonth bool `yaml:"groupByMonth,omitempty"`
+	// PathPattern is the path of the pages in the home path, a template given the page: ID, Position,
+	// Slug, Name, Title, Date, Lastmod, Section and Props, its properties by name. The slug function
+	// makes a path segment of any text. E.g. {{.Position}}/{{.Date.Year}}/{{.Date.Month}}/{{.Slug}}/index.md
+	// writes page bundles, {{.Position}}/{{.Slug}}.md single files. The sections are bundles written to
+	// _index.md. Child pages are nested in their parent and pages with a FileName are written to their
+	// position as named. Default is the position, the day with GroupByMonth, then the slug
+	PathPattern string `yaml:"pathPattern,omitempty"`
+	// MediaPattern is the folder of the media files of a page, given the same and Dir, the folder of the
+	// page. Default is {{.Dir}}/media. A folder in static is linked from the root of the site,
+	// e.g. static/media/{{.Slug}}, others relative to the page
+	MediaPattern string `yaml:"mediaPattern,omitempty"`
 	Template     string `yaml:"template,omitempty"`
+	// SettingDirs are the folders of the home path the setting pages can write to, or patterns of
+	// them, e.g. [., config/*]. Default is ., config, config/*, data, i18n and static. No page
+	// can write out of the home path
+	SettingDirs []string `yaml:"settingDirs,omitempty"`
+	// LinkStyle of the links between published pages: relref (default) or relative
+	LinkStyle string `yaml:"linkStyle,omitempty"`
+	// UnpublishedLink is used for links to pages which are not published:
+	// notion (default) keeps the notion url, text drops the link, anything else is used as the url
+	UnpublishedLink string  `yaml:"unpublishedLink,omitempty"`
+	Mention         Mention `yaml:"mention,omitempty"`
+	// ChildDatabase is how the inline databases of a page are rendered
+	ChildDatabase ChildDatabases `yaml:"childDatabase,omitempty"`
+	// VideoShortcode renders uploaded videos and links to video files with this shortcode
+	// instead of an html5 video element, e.g. video for {{< video src="media/a.mp4" type="video/mp4" >}}
+	VideoShortcode string `yaml:"videoShortcode,omitempty"`
+	// Embeds are more embed providers, tried before the builtin ones
+	Embeds []EmbedProvider `yaml:"embeds,omitempty"`
+	// Code is how the code blocks are rendered
+	Code CodeBlocks `yaml:"code,omitempty"`
+	// Callout is how the callouts are rendered
+	Callout Callouts `yaml:"callout,omitempty"`
+	// Bookmark is how the link previews of the bookmarks are fetched
+	Bookmark Bookmarks `yaml:"bookmark,omitempty"`
+	// Summary is where the <!--more--> separator goes
+	Summary Summaries `yaml:"summary,omitempty"`
+	// Image is how the downloaded images are processed
+	Image Images `yaml:"image,omitempty"`
+	// Storage is where the media files are kept
+	Storage Storage `yaml:"storage,omitempty"`
+	// Download is how the media files are fetched
+	Download Downloads `yaml:"download,omitempty"`
+	// Slug is how the pages are named in their paths, after their Slug property, or their Name
+	Slug Slugs `yaml:"slug,omitempty"`
+}
+
+type Slugs struct {
+	// KeepCJK keeps the chinese, japanese and korean characters in the paths, the default as they
+	// were kept before. false romanizes the kana and the hangul and drops the han characters
+	KeepCJK *bool `yaml:"keepCJK,omitempty"`
+	// MaxLength of a slug in characters, default 80. A longer slug is cut at a dash
+	MaxLength int `yaml:"maxLength,omitempty"`
+}
+
+type Downloads struct {
+	// Timeout of a download, default 60s
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Retries of a download failing with a network or server error, default 2, -1 for none
+	Retries int `yaml:"retries,omitempty"`
+	// MaxSize of a file in bytes, default 100 MiB
+	MaxSize int64 `yaml:"maxSize,omitempty"`
+	// ContentTypes are the types of files allowed, e.g. [image/*, application/pdf]. Default is any type
+	ContentTypes []string `yaml:"contentTypes,omitempty"`
+	// Placeholder is linked instead of a file which can't be downloaded, e.g. /images/missing.png.
+	// Default keeps the url of the file. The failures are warnings of the run either way
+	Placeholder string `yaml:"placeholder,omitempty"`
+}
+
+type Storage struct {
+	// Type is local (default) to write the media files next to the pages,
+	// or s3 to upload them to an s3 compatible bucket and link them there
+	Type string `yaml:"type,omitempty"`
+	// Endpoint of the s3 api, e.g. https://s3.eu-west-1.amazonaws.com or http://localhost:9000.
+	// The credentials are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+	Endpoint string `yaml:"endpoint,omitempty"`
+	// Region of the bucket, default AWS_REGION or us-east-1
+	Region string `yaml:"region,omitempty"`
+	Bucket string `yaml:"bucket,omitempty"`
+	// Prefix of the object keys, e.g. media
+	Prefix string `yaml:"prefix,omitempty"`
+	// PublicURL the objects are linked from, e.g. a cdn in front of the bucket. Default is the endpoint
+	PublicURL string `yaml:"publicUrl,omitempty"`
+	// Dir is the local folder the files are written to before they are uploaded, default .notion-site/media
+	Dir string `yaml:"dir,omitempty"`
+}
+
+type Images struct {
+	// Process scales down and re-encodes the jpeg and png images, the page shows them
+	// with their width and height and a srcset. Off by default: images are used as downloaded
+	Process bool `yaml:"process,omitempty"`
+	// MaxWidth of the images, default 1600
+	MaxWidth int `yaml:"maxWidth,omitempty"`
+	// Quality of the jpeg images from 1 to 100, default 82. Png images are compressed losslessly
+	Quality int `yaml:"quality,omitempty"`
+	// Widths of the smaller copies in the srcset, e.g. [480, 960]
+	Widths []int `yaml:"widths,omitempty"`
+	// WebP writes lossless webp copies, kept when they are smaller: screenshots mostly, photos rarely
+	WebP bool `yaml:"webp,omitempty"`
+	// Shortcode renders the processed images, and the ones with a placeholder, with this shortcode, e.g. figure, instead of a picture element
+	Shortcode string `yaml:"shortcode,omitempty"`
+	// Placeholder shows the downloaded images while they load: lqip, a tiny blurred copy as a data url,
+	// or blurhash. Both come with the dominant color of the image. Off by default. The images with a
+	// placeholder are shown with an img element, or the shortcode, processed or not
+	Placeholder string `yaml:"placeholder,omitempty"`
+}
+
+type Summaries struct {
+	// Break is where the separator goes: paragraph (default) after the first paragraph, blocks after
+	// the first Blocks blocks, divider at the first divider, marker at the Marker paragraph or none
+	Break  string `yaml:"break,omitempty"`
+	Blocks int    `yaml:"blocks,omitempty"`
+	// Marker is the text of the paragraph standing for the separator, default <!--more-->
+	Marker string `yaml:"marker,omitempty"`
+	// FrontMatter writes the Description property as the summary front matter field
+	FrontMatter bool `yaml:"frontMatter,omitempty"`
+}
+
+type Bookmarks struct {
+	// CacheDir keeps the fetched opengraph metadata, default .notion-site/opengraph
+	CacheDir string `yaml:"cacheDir,omitempty"`
+	// TTL of the cached metadata, default 168h
+	TTL time.Duration `yaml:"ttl,omitempty"`
+	// Timeout of a fetch, default 10s
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// DownloadImages saves the preview images and favicons to the media folder of the page instead of linking them
+	DownloadImages bool `yaml:"downloadImages,omitempty"`
+	// Offline renders the bookmarks from the cache only, and their images from the media files
+	// downloaded before, set by the --offline flag
+	Offline bool `yaml:"offline,omitempty"`
+}
+
+type Callouts struct {
+	// Target is the admonition syntax: hugo (default) for the callout shortcode as before,
+	// {{< callout emoji="💡" text="..." type="tip" >}} followed by the children of the callout,
+	// admonition for the paired {{% callout type="tip" %}}...{{% /callout %}} wrapping them,
+	// github for alerts, docusaurus for :::tip or mkdocs for !!! tip
+	Target string `yaml:"target,omitempty"`
+	// Shortcode is the name of the hugo shortcode, default callout
+	Shortcode string `yaml:"shortcode,omitempty"`
+	// Types maps an emoji or a background color (red_background) to an admonition type,
+	// before the builtin 💡 tip, ⚠️ warning, ❗ danger...
+	Types map[string]string `yaml:"types,omitempty"`
+	// DefaultType is the type of the other callouts, default note
+	DefaultType string `yaml:"defaultType,omitempty"`
+}
+
+type CodeBlocks struct {
+	// Render is fence (default) for code fences with the caption options as attributes,
+	// or highlight for the hugo highlight shortcode under a file name header
+	Render string `yaml:"render,omitempty"`
+	// Languages maps more notion language names to the highlighter ones, e.g. plain text: plaintext
+	Languages map[string]string `yaml:"languages,omitempty"`
+}
+
+type ChildDatabases struct {
+	// Render is table (default) to render it in place as a markdown table, or data to write
+	// it to data/<name>.json|yaml and reference it with the notion-database shortcode
+	Render string `yaml:"render,omitempty"`
+	// DataFormat of the data files: json (default) or yaml
+	DataFormat string `yaml:"dataFormat,omitempty"`
+	// Columns are the visible properties in order, default is the title then the others by name
+	Columns []string `yaml:"columns,omitempty"`
+	// SortBy is the property the rows are sorted by, in ascending (default) or descending SortDirection
+	SortBy        string `yaml:"sortBy,omitempty"`
+	SortDirection string `yaml:"sortDirection,omitempty"`
+	// Databases overrides the settings above per database title
+	Databases map[string]ChildDatabases `yaml:"databases,omitempty"`
+	// Containers makes any page holding a child database a container, as before the inline databases
+	// were rendered: the page is not published, the pages of its child database are. By default only
+	// the pages of Type folder are containers, the child databases of the others are rendered in place
+	Containers bool `yaml:"containers,omitempty"`
+}
+
+type Mention struct {
+	// Users maps a user name or id to a profile link, users without one are rendered as their name
+	Users map[string]string `yaml:"users,omitempty"`
+	// DateLayout is the go time layout of dates, default 2006-01-02
+	DateLayout string `yaml:"dateLayout,omitempty"`
+	// DateTimeLayout is the go time layout of dates with a time, default 2006-01-02 15:04
+	DateTimeLayout string `yaml:"dateTimeLayout,omitempty"`
+	// TimeZone dates with a time are shown in, e.g. Asia/Shanghai. Default is the zone notion returns
+	TimeZone string `yaml:"timeZone,omitempty"`
 }
 
 type Config struct {
@@ -0,0 +1,343 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/dstotijn/go-notion"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	databaseRenderTable = "table"
+	databaseRenderData  = "data"
+
+	dataFormatJSON = "json"
+	dataFormatYAML = "yaml"
+
+	dataDir = "data"
+)
+
+// InlineDatabase is a database living inside a page, with its rows
+type InlineDatabase struct {
+	ID      string
+	Title   string
+	Columns []string
+	Rows    []notion.Page
+	View    ChildDatabases
+}
+
+// checkChildDatabases fails for an unknown childDatabase.render or dataFormat, at the top level or
+// of a database in databases, which would only fail once a page of the database is rendered
+func checkChildDatabases(config ChildDatabases) error {
+	if err := checkChildDatabase("childDatabase", config); err != nil {
+		return err
+	}
+	for title, override := range config.Databases {
+		if err := checkChildDatabase("childDatabase.databases."+title, override); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkChildDatabase(key string, config ChildDatabases) error {
+	switch config.Render {
+	case "", databaseRenderTable, databaseRenderData:
+	default:
+		return fmt.Errorf("unknown %s.render %q: table or data", key, config.Render)
+	}
+	switch config.DataFormat {
+	case "", dataFormatJSON, dataFormatYAML:
+	default:
+		return fmt.Errorf("unknown %s.dataFormat %q: json or yaml", key, config.DataFormat)
+	}
+	return nil
+}
+
+// forDatabase returns the config of a database, overridden by its entry in Databases
+func (c ChildDatabases) forDatabase(title string) ChildDatabases {
+	view := c
+	// viper lower cases the map keys
+	override, ok := c.Databases[strings.ToLower(title)]
+	if !ok {
+		override, ok = c.Databases[title]
+	}
+	if !ok {
+		return view
+	}
+	if override.Render != "" {
+		view.Render = override.Render
+	}
+	if override.DataFormat != "" {
+		view.DataFormat = override.DataFormat
+	}
+	if len(override.Columns) > 0 {
+		view.Columns = override.Columns
+	}
+	if override.SortBy != "" {
+		view.SortBy = override.SortBy
+		view.SortDirection = override.SortDirection
+	}
+	return view
+}
+
+// databaseColumns lists the configured columns which exist, default is the title then the others by name
+func databaseColumns(properties notion.DatabaseProperties, configured []string) []string {
+	var columns []string
+	if len(configured) > 0 {
+		for _, name := range configured {
+			if _, ok := properties[name]; ok {
+				columns = append(columns, name)
+			}
+		}
+		return columns
+	}
+	for name, prop := range properties {
+		if prop.Type != notion.DBPropTypeTitle {
+			columns = append(columns, name)
+		}
+	}
+	sort.Strings(columns)
+	for name, prop := range properties {
+		if prop.Type == notion.DBPropTypeTitle {
+			columns = append([]string{name}, columns...)
+		}
+	}
+	return columns
+}
+
+// Name is the file name of the database data file
+func (db *InlineDatabase) Name() string {
+	if db.Title == "" {
+		return normalizeID(db.ID)
+	}
+	return AnchorID(db.Title)
+}
+
+// Table renders the database as a markdown table
+func (db *InlineDatabase) Table(opts *richTextOptions) string {
+	if len(db.Columns) == 0 {
+		return ""
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString("|")
+	for _, column := range db.Columns {
+		buf.WriteString(" " + escapeMarkdown(column) + " |")
+	}
+	buf.WriteString("\n|")
+	for range db.Columns {
+		buf.WriteString(" --- |")
+	}
+	buf.WriteString("\n")
+	for _, row := range db.Rows {
+		props, _ := row.Properties.(notion.DatabasePageProperties)
+		buf.WriteString("|")
+		for _, column := range db.Columns {
+			cell := strings.ReplaceAll(propertyMarkdown(props[column], opts), "\n", "<br>")
+			buf.WriteString(" " + cell + " |")
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+// Data returns the rows as a list of column -> value maps
+func (db *InlineDatabase) Data(config Mention) []map[string]interface{} {
+	data := make([]map[string]interface{}, 0, len(db.Rows))
+	for _, row := range db.Rows {
+		props, _ := row.Properties.(notion.DatabasePageProperties)
+		item := make(map[string]interface{}, len(db.Columns))
+		for _, column := range db.Columns {
+			item[column] = propertyValue(props[column], config)
+		}
+		data = append(data, item)
+	}
+	return data
+}
+
+// WriteData writes the rows to data/<name>.json|yaml under the home path, for hugo to read them.
+// It tells whether the file changed.
+func (db *InlineDatabase) WriteData(homePath string, config Mention) (string, bool, error) {
+	format := db.View.DataFormat
+	if format == "" {
+		format = dataFormatJSON
+	}
+	var out []byte
+	var err error
+	switch format {
+	case dataFormatJSON:
+		out, err = json.MarshalIndent(db.Data(config), "", "  ")
+	case dataFormatYAML:
+		out, err = yaml.Marshal(db.Data(config))
+	default:
+		return "", false, fmt.Errorf("unsupported data format %s", format)
+	}
+	if err != nil {
+		return "", false, err
+	}
+	dir := filepath.Join(homePath, dataDir)
+	if err := os.MkdirAll(dir, defaultPermission); err != nil {
+		return "", false, err
+	}
+	path := filepath.Join(dir, db.Name()+"."+format)
+	changed, err := writeFile(path, out)
+	return path, changed, err
+}
+
+// propertyMarkdown renders a database property as inline markdown
+func propertyMarkdown(prop notion.DatabasePageProperty, opts *richTextOptions) string {
+	switch prop.Type {
+	case notion.DBPropTypeTitle:
+		return convertRichText(prop.Title, opts)
+	case notion.DBPropTypeRichText:
+		return convertRichText(prop.RichText, opts)
+	case notion.DBPropTypeURL:
+		if prop.URL != nil && *prop.URL != "" {
+			return fmt.Sprintf("[%s](%s)", escapeMarkdown(*prop.URL), linkDestination(*prop.URL))
+		}
+		return ""
+	case notion.DBPropTypeCheckbox:
+		if prop.Checkbox != nil && *prop.Checkbox {
+			return "✔"
+		}
+		return ""
+	}
+	var config Mention
+	if opts != nil {
+		config = opts.mention
+	}
+	switch v := propertyValue(prop, config).(type) {
+	case nil:
+		return ""
+	case []string:
+		for i := range v {
+			v[i] = escapeMarkdown(v[i])
+		}
+		return strings.Join(v, ", ")
+	case string:
+		return escapeMarkdown(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return escapeMarkdown(fmt.Sprint(v))
+	}
+}
+
+// propertyValue returns the plain value of a database property: a string, number, bool, list of strings or nil
+func propertyValue(prop notion.DatabasePageProperty, config Mention) interface{} {
+	switch prop.Type {
+	case notion.DBPropTypeTitle:
+		return plainText(prop.Title)
+	case notion.DBPropTypeRichText:
+		return plainText(prop.RichText)
+	case notion.DBPropTypeNumber:
+		if prop.Number != nil {
+			return *prop.Number
+		}
+	case notion.DBPropTypeSelect:
+		if prop.Select != nil {
+			return prop.Select.Name
+		}
+	case notion.DBPropTypeStatus:
+		if prop.Status != nil {
+			return prop.Status.Name
+		}
+	case notion.DBPropTypeMultiSelect:
+		names := make([]string, 0, len(prop.MultiSelect))
+		for _, option := range prop.MultiSelect {
+			names = append(names, option.Name)
+		}
+		return names
+	case notion.DBPropTypeDate:
+		if prop.Date != nil {
+			return formatMentionDate(prop.Date, config)
+		}
+	case notion.DBPropTypePeople:
+		names := make([]string, 0, len(prop.People))
+		for _, user := range prop.People {
+			names = append(names, user.Name)
+		}
+		return names
+	case notion.DBPropTypeFiles:
+		urls := make([]string, 0, len(prop.Files))
+		for _, file := range prop.Files {
+			if file.File != nil {
+				urls = append(urls, file.File.URL)
+			} else if file.External != nil {
+				urls = append(urls, file.External.URL)
+			}
+		}
+		return urls
+	case notion.DBPropTypeCheckbox:
+		if prop.Checkbox != nil {
+			return *prop.Checkbox
+		}
+	case notion.DBPropTypeURL:
+		if prop.URL != nil {
+			return *prop.URL
+		}
+	case notion.DBPropTypeEmail:
+		if prop.Email != nil {
+			return *prop.Email
+		}
+	case notion.DBPropTypePhoneNumber:
+		if prop.PhoneNumber != nil {
+			return *prop.PhoneNumber
+		}
+	case notion.DBPropTypeFormula:
+		if f := prop.Formula; f != nil {
+			switch {
+			case f.String != nil:
+				return *f.String
+			case f.Number != nil:
+				return *f.Number
+			case f.Boolean != nil:
+				return *f.Boolean
+			case f.Date != nil:
+				return formatMentionDate(f.Date, config)
+			}
+		}
+	case notion.DBPropTypeRollup:
+		if r := prop.Rollup; r != nil {
+			switch {
+			case r.Number != nil:
+				return *r.Number
+			case r.Date != nil:
+				return formatMentionDate(r.Date, config)
+			case r.Array != nil:
+				values := make([]string, 0, len(r.Array))
+				for _, item := range r.Array {
+					if v := propertyValue(item, config); v != nil {
+						values = append(values, fmt.Sprint(v))
+					}
+				}
+				return values
+			}
+		}
+	case notion.DBPropTypeCreatedTime:
+		if prop.CreatedTime != nil {
+			return prop.CreatedTime.Format(defaultDateTimeLayout)
+		}
+	case notion.DBPropTypeLastEditedTime:
+		if prop.LastEditedTime != nil {
+			return prop.LastEditedTime.Format(defaultDateTimeLayout)
+		}
+	case notion.DBPropTypeCreatedBy:
+		if prop.CreatedBy != nil {
+			return prop.CreatedBy.Name
+		}
+	case notion.DBPropTypeLastEditedBy:
+		if prop.LastEditedBy != nil {
+			return prop.LastEditedBy.Name
+		}
+	}
+	return nil
+}
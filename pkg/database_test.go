@@ -0,0 +1,124 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// testDatabase is an inline database of two rows with a title, a multi select, a number and a checkbox
+func testDatabase(view ChildDatabases) *InlineDatabase {
+	text := func(s string) []notion.RichText {
+		return []notion.RichText{{Type: notion.RichTextTypeText, Text: &notion.Text{Content: s}, PlainText: s}}
+	}
+	score, done := 3.5, true
+	return &InlineDatabase{
+		ID:      "0123456789abcdef0123456789abcdef",
+		Title:   "Reading List",
+		Columns: []string{"Name", "Tags", "Score", "Done"},
+		Rows: []notion.Page{
+			{Properties: notion.DatabasePageProperties{
+				"Name":  {Type: notion.DBPropTypeTitle, Title: text("Go | Rust")},
+				"Tags":  {Type: notion.DBPropTypeMultiSelect, MultiSelect: []notion.SelectOptions{{Name: "a"}, {Name: "b"}}},
+				"Score": {Type: notion.DBPropTypeNumber, Number: &score},
+				"Done":  {Type: notion.DBPropTypeCheckbox, Checkbox: &done},
+			}},
+			{Properties: notion.DatabasePageProperties{
+				"Name": {Type: notion.DBPropTypeTitle, Title: text("Empty")},
+			}},
+		},
+		View: view,
+	}
+}
+
+func TestInlineDatabaseTable(t *testing.T) {
+	got := testDatabase(ChildDatabases{}).Table(&richTextOptions{})
+	want := "| Name | Tags | Score | Done |\n" +
+		"| --- | --- | --- | --- |\n" +
+		"| Go \\| Rust | a, b | 3.5 | ✔ |\n" +
+		"| Empty |  |  |  |\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestInlineDatabaseWriteData(t *testing.T) {
+	for _, c := range []struct {
+		format string
+		file   string
+		want   string
+	}{
+		{"", "reading-list.json", `[
+  {
+    "Done": true,
+    "Name": "Go | Rust",
+    "Score": 3.5,
+    "Tags": [
+      "a",
+      "b"
+    ]
+  },
+  {
+    "Done": null,
+    "Name": "Empty",
+    "Score": null,
+    "Tags": null
+  }
+]`},
+		{"yaml", "reading-list.yaml", `- Done: true
+  Name: Go | Rust
+  Score: 3.5
+  Tags:
+    - a
+    - b
+- Done: null
+  Name: Empty
+  Score: null
+  Tags: null
+`},
+	} {
+		t.Run(c.file, func(t *testing.T) {
+			dir := t.TempDir()
+			db := testDatabase(ChildDatabases{DataFormat: c.format})
+			path, changed, err := db.WriteData(dir, Mention{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path != filepath.Join(dir, dataDir, c.file) || !changed {
+				t.Errorf("wrote %s changed %v, want %s", path, changed, c.file)
+			}
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(raw) != c.want {
+				t.Errorf("got:\n%s\nwant:\n%s", raw, c.want)
+			}
+			if _, changed, _ := db.WriteData(dir, Mention{}); changed {
+				t.Error("the same rows changed the file")
+			}
+		})
+	}
+}
+
+func TestCheckChildDatabases(t *testing.T) {
+	for _, c := range []struct {
+		config ChildDatabases
+		ok     bool
+	}{
+		{ChildDatabases{}, true},
+		{ChildDatabases{Render: "data", DataFormat: "yaml"}, true},
+		{ChildDatabases{Render: "table", DataFormat: "json"}, true},
+		{ChildDatabases{Databases: map[string]ChildDatabases{"books": {Render: "data", DataFormat: "yaml"}}}, true},
+		{ChildDatabases{Render: "list"}, false},
+		{ChildDatabases{DataFormat: "toml"}, false},
+		{ChildDatabases{Databases: map[string]ChildDatabases{"books": {DataFormat: "yml"}}}, false},
+		{ChildDatabases{Databases: map[string]ChildDatabases{"books": {Render: "tables"}}}, false},
+	} {
+		if err := checkChildDatabases(c.config); (err == nil) != c.ok {
+			t.Errorf("%+v: got %v", c.config, err)
+		}
+	}
+}
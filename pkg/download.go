@@ -0,0 +1,181 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDownloadTimeout = 60 * time.Second
+	defaultDownloadRetries = 2
+	defaultDownloadMaxSize = 100 << 20
+	downloadRetryDelay     = time.Second
+	downloadMaxRetryDelay  = 30 * time.Second
+)
+
+var errDownloadTooLarge = errors.New("file too large")
+
+// Downloader fetches the media files: with a timeout, retrying the server errors,
+// refusing the error pages, the files too large and the types not allowed
+type Downloader struct {
+	client       *http.Client
+	retries      int
+	maxSize      int64
+	contentTypes []string
+	sleep        func(time.Duration)
+}
+
+func NewDownloader(config Downloads) *Downloader {
+	d := &Downloader{
+		client:       &http.Client{Timeout: config.Timeout},
+		retries:      config.Retries,
+		maxSize:      config.MaxSize,
+		contentTypes: config.ContentTypes,
+		sleep:        time.Sleep,
+	}
+	if d.client.Timeout <= 0 {
+		d.client.Timeout = defaultDownloadTimeout
+	}
+	if d.retries < 0 {
+		d.retries = 0
+	} else if d.retries == 0 {
+		d.retries = defaultDownloadRetries
+	}
+	if d.maxSize <= 0 {
+		d.maxSize = defaultDownloadMaxSize
+	}
+	return d
+}
+
+// downloadError is a failed download, retryable for network and server errors
+type downloadError struct {
+	err        error
+	retryable  bool
+	retryAfter time.Duration
+}
+
+func (e *downloadError) Error() string {
+	return e.err.Error()
+}
+
+// mediaStore writes a downloaded body, check refuses the file before it takes the place of its name
+type mediaStore func(body io.Reader, contentType string, check func(*MediaEntry) error) (*MediaEntry, error)
+
+// Fetch downloads a file and hands its body to store, the body is cut at the max size.
+// The stored file must be of the expected type when one is given, e.g. image/
+func (d *Downloader) Fetch(mediaURL string, expect string, store mediaStore) (*MediaEntry, error) {
+	var err error
+	for attempt := 0; attempt <= d.retries; attempt++ {
+		if attempt > 0 {
+			delay := downloadRetryDelay << (attempt - 1)
+			var de *downloadError
+			if errors.As(err, &de) && de.retryAfter > delay {
+				delay = de.retryAfter
+			}
+			if delay > downloadMaxRetryDelay {
+				delay = downloadMaxRetryDelay
+			}
+			d.sleep(delay)
+		}
+		var entry *MediaEntry
+		entry, err = d.fetch(mediaURL, expect, store)
+		if err == nil {
+			return entry, nil
+		}
+		var de *downloadError
+		if !errors.As(err, &de) || !de.retryable {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("%s, after %d attempts", err, d.retries+1)
+}
+
+func (d *Downloader) fetch(mediaURL string, expect string, store mediaStore) (*MediaEntry, error) {
+	resp, err := d.client.Get(mediaURL)
+	if err != nil {
+		return nil, &downloadError{err: err, retryable: true}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := &downloadError{err: fmt.Errorf("status %s", resp.Status)}
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+			err.retryable = true
+			if seconds, parseErr := strconv.Atoi(resp.Header.Get("Retry-After")); parseErr == nil {
+				err.retryAfter = time.Duration(seconds) * time.Second
+			}
+		case resp.StatusCode == http.StatusForbidden && isNotionHosted(resp.Request.URL):
+			err.err = fmt.Errorf("status %s: the signed notion url has expired", resp.Status)
+		}
+		return nil, err
+	}
+	if resp.ContentLength > d.maxSize {
+		return nil, fmt.Errorf("%w: %d bytes, the max size is %d", errDownloadTooLarge, resp.ContentLength, d.maxSize)
+	}
+	body := &maxSizeReader{reader: resp.Body, remaining: d.maxSize}
+	entry, err := store(body, resp.Header.Get("Content-Type"), func(entry *MediaEntry) error {
+		return d.checkType(entry, expect)
+	})
+	if errors.Is(err, errDownloadTooLarge) {
+		return nil, fmt.Errorf("%w: the max size is %d bytes", err, d.maxSize)
+	}
+	if err != nil {
+		// reading the body again may work, writing to a full or read only disk won't
+		return nil, &downloadError{err: err, retryable: body.err != nil}
+	}
+	return entry, nil
+}
+
+// checkType refuses the files of a type not allowed or not expected, by the type of the
+// stored file: notion serves its files as binary/octet-stream
+func (d *Downloader) checkType(entry *MediaEntry, expect string) error {
+	contentType, _, _ := mime.ParseMediaType(typeByExtension(filepath.Ext(entry.File)))
+	if contentType == "" {
+		contentType, _, _ = mime.ParseMediaType(entry.ContentType)
+	}
+	if expect != "" && !strings.HasPrefix(contentType, expect) {
+		return fmt.Errorf("got a file of type %q, not %s", contentType, strings.TrimSuffix(expect, "/"))
+	}
+	if len(d.contentTypes) == 0 {
+		return nil
+	}
+	for _, allowed := range d.contentTypes {
+		if allowed == contentType || strings.HasSuffix(allowed, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(allowed, "*")) {
+			return nil
+		}
+	}
+	return fmt.Errorf("type %q is not allowed", contentType)
+}
+
+// maxSizeReader fails when more than remaining bytes are read
+type maxSizeReader struct {
+	reader    io.Reader
+	remaining int64
+	// err is the error reading the body, a network error
+	err error
+}
+
+func (r *maxSizeReader) Read(p []byte) (int, error) {
+	if r.remaining < 0 {
+		return 0, errDownloadTooLarge
+	}
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+	n, err := r.reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return n, errDownloadTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,81 @@
+package pkg
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestFetchOctetStream checks a video served as binary/octet-stream, as notion serves its files,
+// is typed after its extension
+func TestFetchOctetStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "binary/octet-stream")
+		w.Write([]byte("\x00\x00\x00\x18ftypmp42"))
+	}))
+	defer server.Close()
+	d := NewDownloader(Downloads{ContentTypes: []string{"video/*"}})
+	dir := t.TempDir()
+	url := server.URL + "/a.mp4?X-Amz-Signature=x"
+	entry, err := d.Fetch(url, "video/", func(body io.Reader, contentType string, check func(*MediaEntry) error) (*MediaEntry, error) {
+		return storeMedia(body, contentType, url, dir, check)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := typeByExtension(filepath.Ext(entry.File)); got != "video/mp4" {
+		t.Errorf("type of %s: %s, want video/mp4", entry.File, got)
+	}
+}
+
+// TestFetchStoreError checks a file which can't be stored is not downloaded again
+func TestFetchStoreError(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("data"))
+	}))
+	defer server.Close()
+	d := NewDownloader(Downloads{})
+	d.sleep = func(time.Duration) {}
+	_, err := d.Fetch(server.URL+"/a.txt", "", func(body io.Reader, contentType string, check func(*MediaEntry) error) (*MediaEntry, error) {
+		io.Copy(io.Discard, body)
+		return nil, errors.New("no space left on device")
+	})
+	if err == nil || requests != 1 {
+		t.Errorf("got %v after %d requests, want an error after 1", err, requests)
+	}
+}
+
+// TestFetchWrongTypeKeepsFile checks a file of the wrong type is not stored, and the file of
+// the same content already stored for another block is kept
+func TestFetchWrongTypeKeepsFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("plain text"))
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	url := server.URL + "/a.txt"
+	store := func(body io.Reader, contentType string, check func(*MediaEntry) error) (*MediaEntry, error) {
+		return storeMedia(body, contentType, url, dir, check)
+	}
+	d := NewDownloader(Downloads{})
+	stored, err := d.Fetch(url, "", store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Fetch(url, "image/", store); err == nil {
+		t.Fatal("no error for a text file expected to be an image")
+	}
+	if _, err := os.Stat(stored.Path); err != nil {
+		t.Errorf("the stored file is gone: %s", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("got %d files, want 1", len(entries))
+	}
+}
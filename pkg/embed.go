@@ -0,0 +1,175 @@
+package pkg
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// EmbedProvider renders the embeds of a site, like an oembed provider without the round trip
+type EmbedProvider struct {
+	Name string `yaml:"name"`
+	// Patterns are regular expressions the url is matched against, their named groups are the params
+	Patterns []string `yaml:"patterns"`
+	// Shortcode renders the embed as {{< shortcode key="value" >}} with the params sorted by name
+	Shortcode string `yaml:"shortcode,omitempty"`
+	// Template renders the embed instead of Shortcode, {name} is replaced by the param,
+	// {url} by the url and {urlquery} by the url escaped for a query string
+	Template string `yaml:"template,omitempty"`
+}
+
+// builtinEmbedProviders are the providers known without configuration, the configured ones are tried first
+var builtinEmbedProviders = []EmbedProvider{
+	{
+		Name: "youtube",
+		Patterns: []string{
+			`youtube\.com/watch\?(?:.*&)?v=(?P<id>[\w-]+)`,
+			`youtube\.com/(?:embed|shorts)/(?P<id>[\w-]+)`,
+			`youtu\.be/(?P<id>[\w-]+)`,
+		},
+		Shortcode: "youtube",
+	},
+	{
+		Name:      "vimeo",
+		Patterns:  []string{`vimeo\.com/(?:video/)?(?P<id>\d+)`},
+		Shortcode: "vimeo",
+	},
+	{
+		Name:     "bilibili",
+		Patterns: []string{`bilibili\.com/video/(?P<id>BV\w+)`, `[?&]bvid=(?P<id>BV\w+)`},
+		Template: `{{< bilibili {id} >}}`,
+	},
+	{
+		Name:      "twitter",
+		Patterns:  []string{`(?:twitter|x)\.com/(?P<user>\w+)/status/(?P<id>\d+)`},
+		Shortcode: "tweet",
+	},
+	{
+		Name:     "gist",
+		Patterns: []string{`gist\.github\.com/(?P<user>[\w-]+)/(?P<id>\w+)`},
+		Template: `{{< gist {user} {id} >}}`,
+	},
+	{
+		Name:     "jsfiddle",
+		Patterns: []string{`jsfiddle\.net/(?P<path>[^?#]+?)/?(?:[?#].*)?$`},
+		Template: `{{< jsfiddle url="{path}" >}}`,
+	},
+	{
+		Name:     "codepen",
+		Patterns: []string{`codepen\.io/(?P<user>[\w-]+)/(?:pen|embed|full)/(?P<id>\w+)`},
+		Template: `{{< iframe "https://codepen.io/{user}/embed/{id}?default-tab=result" >}}`,
+	},
+	{
+		Name:     "figma",
+		Patterns: []string{`figma\.com/(?:file|design|proto|board)/`},
+		Template: `{{< iframe "https://www.figma.com/embed?embed_host=share&url={urlquery}" >}}`,
+	},
+	{
+		Name: "googlemaps",
+		Patterns: []string{
+			`google\.[a-z.]+/maps/place/(?P<q>[^/?#]+)`,
+			`google\.[a-z.]+/maps/.*@(?P<q>-?[\d.]+,-?[\d.]+)`,
+		},
+		Template: `{{< iframe "https://maps.google.com/maps?q={q}&output=embed" >}}`,
+	},
+	{
+		Name:     "spotify",
+		Patterns: []string{`open\.spotify\.com/(?:embed/)?(?P<type>track|album|playlist|episode|show|artist)/(?P<id>\w+)`},
+		Template: `{{< iframe "https://open.spotify.com/embed/{type}/{id}" >}}`,
+	},
+	{
+		Name:     "loom",
+		Patterns: []string{`loom\.com/(?:share|embed)/(?P<id>[\w-]+)`},
+		Template: `{{< iframe "https://www.loom.com/embed/{id}" >}}`,
+	},
+}
+
+var regexEmbedParam = regexp.MustCompile(`\{(\w+)\}`)
+
+type embedProvider struct {
+	EmbedProvider
+	patterns []*regexp.Regexp
+}
+
+// EmbedProviders matches embed urls against the configured then the builtin providers
+type EmbedProviders struct {
+	providers []*embedProvider
+}
+
+// NewEmbedProviders compiles the configured providers followed by the builtin ones,
+// a configured provider replaces the builtin one of the same name
+func NewEmbedProviders(configured []EmbedProvider) (*EmbedProviders, error) {
+	ep := &EmbedProviders{}
+	names := make(map[string]bool)
+	providers := append(append([]EmbedProvider{}, configured...), builtinEmbedProviders...)
+	for _, provider := range providers {
+		if provider.Name != "" && names[provider.Name] {
+			continue
+		}
+		names[provider.Name] = true
+		if provider.Shortcode == "" && provider.Template == "" {
+			return nil, fmt.Errorf("embed provider %s has neither a shortcode nor a template", provider.Name)
+		}
+		p := &embedProvider{EmbedProvider: provider}
+		for _, pattern := range provider.Patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("embed provider %s: %s", provider.Name, err)
+			}
+			p.patterns = append(p.patterns, re)
+		}
+		ep.providers = append(ep.providers, p)
+	}
+	return ep, nil
+}
+
+// Render returns the markdown of an embed and the name of its provider, both empty when no provider matches
+func (ep *EmbedProviders) Render(link string) (string, string) {
+	for _, p := range ep.providers {
+		for _, re := range p.patterns {
+			match := re.FindStringSubmatch(link)
+			if match == nil {
+				continue
+			}
+			params := map[string]string{"url": link, "urlquery": url.QueryEscape(link)}
+			for i, name := range re.SubexpNames() {
+				if name != "" && match[i] != "" {
+					params[name] = match[i]
+				}
+			}
+			return p.render(params), p.Name
+		}
+	}
+	return "", ""
+}
+
+func (p *embedProvider) render(params map[string]string) string {
+	if p.Template != "" {
+		return regexEmbedParam.ReplaceAllStringFunc(p.Template, func(s string) string {
+			if v, ok := params[s[1:len(s)-1]]; ok {
+				return v
+			}
+			return s
+		})
+	}
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		if key != "url" && key != "urlquery" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	// a provider without params gets the url
+	if len(keys) == 0 {
+		keys = append(keys, "url")
+	}
+	b := &strings.Builder{}
+	b.WriteString("{{< " + p.Shortcode)
+	for _, key := range keys {
+		fmt.Fprintf(b, ` %s="%s"`, key, params[key])
+	}
+	b.WriteString(" >}}")
+	return b.String()
+}
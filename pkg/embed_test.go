@@ -0,0 +1,67 @@
+package pkg
+
+import "testing"
+
+func TestEmbedProviders(t *testing.T) {
+	providers, err := NewEmbedProviders(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		link, want, name string
+	}{
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", `{{< youtube id="dQw4w9WgXcQ" >}}`, "youtube"},
+		{"https://www.youtube.com/watch?list=PL1&v=dQw4w9WgXcQ&t=42", `{{< youtube id="dQw4w9WgXcQ" >}}`, "youtube"},
+		{"https://youtu.be/dQw4w9WgXcQ?si=x", `{{< youtube id="dQw4w9WgXcQ" >}}`, "youtube"},
+		{"https://www.youtube.com/shorts/abc-DEF_123", `{{< youtube id="abc-DEF_123" >}}`, "youtube"},
+		{"https://vimeo.com/76979871", `{{< vimeo id="76979871" >}}`, "vimeo"},
+		{"https://twitter.com/golang/status/1234567890", `{{< tweet id="1234567890" user="golang" >}}`, "twitter"},
+		{"https://x.com/golang/status/1234567890?s=20", `{{< tweet id="1234567890" user="golang" >}}`, "twitter"},
+		{"https://gist.github.com/some-user/0a1b2c3d4e", `{{< gist some-user 0a1b2c3d4e >}}`, "gist"},
+		{"https://www.figma.com/file/AbC123/Design?node-id=1%3A2",
+			`{{< iframe "https://www.figma.com/embed?embed_host=share&url=https%3A%2F%2Fwww.figma.com%2Ffile%2FAbC123%2FDesign%3Fnode-id%3D1%253A2" >}}`, "figma"},
+		{"https://www.figma.com/design/AbC123/Design",
+			`{{< iframe "https://www.figma.com/embed?embed_host=share&url=https%3A%2F%2Fwww.figma.com%2Fdesign%2FAbC123%2FDesign" >}}`, "figma"},
+		{"https://example.com/watch?v=dQw4w9WgXcQ", "", ""},
+		{"https://github.com/golang/go", "", ""},
+	} {
+		got, name := providers.Render(c.link)
+		if got != c.want || name != c.name {
+			t.Errorf("%s: got %s %q, want %s %q", c.link, name, got, c.name, c.want)
+		}
+	}
+}
+
+// TestEmbedProvidersConfigured checks a configured provider is tried first and replaces the builtin one of its name
+func TestEmbedProvidersConfigured(t *testing.T) {
+	providers, err := NewEmbedProviders([]EmbedProvider{
+		{Name: "youtube", Patterns: []string{`youtu\.be/(?P<id>[\w-]+)`}, Template: `{{< lite-youtube {id} >}}`},
+		{Name: "slides", Patterns: []string{`docs\.google\.com/presentation/`}, Shortcode: "slides"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		link, want, name string
+	}{
+		{"https://youtu.be/dQw4w9WgXcQ", `{{< lite-youtube dQw4w9WgXcQ >}}`, "youtube"},
+		// the builtin youtube patterns are gone with it
+		{"https://www.youtube.com/shorts/abc", "", ""},
+		{"https://docs.google.com/presentation/d/1/edit", `{{< slides url="https://docs.google.com/presentation/d/1/edit" >}}`, "slides"},
+		{"https://vimeo.com/76979871", `{{< vimeo id="76979871" >}}`, "vimeo"},
+	} {
+		got, name := providers.Render(c.link)
+		if got != c.want || name != c.name {
+			t.Errorf("%s: got %s %q, want %s %q", c.link, name, got, c.name, c.want)
+		}
+	}
+
+	for _, configured := range [][]EmbedProvider{
+		{{Name: "broken", Patterns: []string{`(`}, Shortcode: "x"}},
+		{{Name: "empty", Patterns: []string{`example\.com`}}},
+	} {
+		if _, err := NewEmbedProviders(configured); err == nil {
+			t.Errorf("%+v: no error", configured)
+		}
+	}
+}
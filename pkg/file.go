@@ -1,21 +1,23 @@
 package pkg
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"github.com/dstotijn/go-notion"
 	"io"
-	"net/http"
-	"net/url"
 	"os"
+	"path"
 	"path/filepath"
-	"reflect"
 	"strings"
+	"text/template"
 )
 
 // all user wr | group wr | other user wr
 const defaultPermission = 0755
 const mediaRelativePath = "media"
 const defaultMarkdownName = "index.md"
+const sectionMarkdownName = "_index.md"
 
 type Files struct {
 	Permission               uint32
@@ -30,6 +32,20 @@ type Files struct {
 	DefaultgalleryFolderName string
 	currentWriter            io.Writer
 	CurrentNTPL              string
+	Media                    *MediaIndex
+	// Slug is the folder of the current page, or its file name without extension
+	Slug string
+	// Downloader fetches the media files
+	Downloader *Downloader
+	// Placeholder replaces the url of a media file which can't be downloaded, empty to keep the url
+	Placeholder string
+	// Storage keeps the media files, next to the pages by default
+	Storage MediaStorage
+	// publicLink makes the links to the media files public urls, nil for relative links
+	publicLink *template.Template
+	// mediaFolderLink links the media folder of the page when it is set by the media pattern,
+	// empty for the media folder next to the page
+	mediaFolderLink string
 }
 
 func NewFiles(config Config) (files *Files) {
@@ -39,11 +55,40 @@ func NewFiles(config Config) (files *Files) {
 		//Position:               position,
 		DefaultMarkdownName:    defaultMarkdownName,
 		DefaultMediaFolderName: mediaRelativePath,
+		Media:                  LoadMediaIndex(filepath.Join(config.HomePath, defaultMediaIndexPath)),
+		Storage:                LocalStorage{},
+		Downloader:             NewDownloader(config.Download),
+		Placeholder:            config.Download.Placeholder,
 	}
 	files.MediaPath = filepath.Join(config.HomePath, files.Position, mediaRelativePath)
 	return
 }
 
+// writeFile writes data through a temporary file renamed into place: a file is never left half
+// written. A file with the same bytes already is left as it is, with its mtime. It tells whether
+// the file changed.
+func writeFile(path string, data []byte) (bool, error) {
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, data) {
+		return false, nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp.Name(), path)
+}
+
 func (files *Files) mkdirHomePath() error {
 	return os.MkdirAll(files.HomePath, os.FileMode(files.Permission))
 }
@@ -51,166 +96,358 @@ func (files *Files) mkdirHomePath() error {
 func (files *Files) mkdirPositionPath(position string) error {
 	err := os.MkdirAll(filepath.Join(files.HomePath, position), os.FileMode(files.Permission))
 	if err != nil {
-		fmt.Errorf("couldn't create content folder: %s", err)
+		return fmt.Errorf("couldn't create content folder: %s", err)
 	}
-	return err
+	return nil
 }
 
 func (files *Files) mkdirPath(path string) error {
 	err := os.MkdirAll(path, os.FileMode(files.Permission))
 	if err != nil {
-		fmt.Errorf("couldn't create content folder: %s", err)
+		return fmt.Errorf("couldn't create content folder: %s", err)
 	}
-	return err
+	return nil
 }
 
-func (ns *NotionSite) getArticleFolderPath() string {
-	escapedTitle := strings.ReplaceAll(
-		strings.ToValidUTF8(
-			strings.ToLower(strings.TrimSpace(ns.currentPageProp.Name)),
-			"",
-		),
-		" ", "-",
-	)
+// pageSlug names a page in its path after its Slug property, or its Name. A page whose
+// name has nothing to keep is named after its id.
+func (ns *NotionSite) pageSlug() string {
+	name := ns.currentPageProp.Slug
+	if name == "" {
+		name = ns.currentPageProp.GetFileName()
+	}
+	slug := ns.slugs.Slug(name)
+	if slug == "" {
+		slug = shortID(ns.currentPage.ID)
+	}
+	return slug
+}
+
+func (ns *NotionSite) getArticleFolderPath(slug string) string {
+	// child pages are nested in the folder of their parent
+	if ns.currentPageProp.ParentFolder != "" {
+		return slug
+	}
 	if ns.config.GroupByMonth {
-		return filepath.Join(ns.currentPageProp.CreateAt.Format("2006-01-02"), escapedTitle)
+		return filepath.Join(ns.currentPageProp.CreateAt.Format("2006-01-02"), slug)
 	}
 
-	return escapedTitle
+	return slug
 }
 
+// getFilename is the file of a setting page, its name lowercased with dashes for spaces,
+// or the slug of the FileName property of a page with a custom file name
 func (ns *NotionSite) getFilename() string {
 	filename := ns.currentPageProp.GetFileName()
-	name := strings.ReplaceAll(
-		strings.ToValidUTF8(
-			strings.ToLower(strings.TrimSpace(filename)),
-			"",
-		),
-		" ", "-",
-	)
-	if !ns.currentPageProp.IsSettingFile && !strings.Contains(filename, ".md") {
-		name += ".md"
+	if ns.currentPageProp.IsSettingFile {
+		return strings.ReplaceAll(
+			strings.ToValidUTF8(
+				strings.ToLower(strings.TrimSpace(filename)),
+				"",
+			),
+			" ", "-",
+		)
+	}
+	slug := ns.slugs.Slug(strings.TrimSuffix(filename, ".md"))
+	if slug == "" {
+		slug = shortID(ns.currentPage.ID)
 	}
-	return name
+	return slug + ".md"
 }
 
-func (ns *NotionSite) SetFileInfo(position string) {
+// SetFileInfo sets the paths of the current page. It fails for a page written out of the
+// home path, or a setting file out of the setting folders.
+func (ns *NotionSite) SetFileInfo(position string) error {
 	ns.files.Position = position
 	if ns.currentPageProp.IsSettingFile {
 		ns.files.FileName = ns.getFilename()
 		ns.files.FileFolderPath = filepath.Join(ns.config.HomePath, ns.files.Position)
 		ns.files.FilePath = filepath.Join(ns.files.FileFolderPath, ns.files.FileName)
-	} else if ns.currentPageProp.IsCustomNameFile {
+		return ns.checkSettingPath()
+	}
+	ns.setFilePaths("")
+	if ns.currentPageProp.IsFolder() {
+		return ns.checkInsideHome(ns.files.FileFolderPath)
+	}
+	// two pages of the same slug: the first one keeps it, the next ones get their id appended
+	if owner := ns.slugs.Claim(ns.pagePath(), ns.currentPage.ID); owner != "" {
+		taken := ns.files.FilePath
+		ns.setFilePaths(shortID(ns.currentPage.ID))
+		if !ns.slugs.Claimed(ns.pagePath()) {
+			ns.report.Warnf("page %s: %s is the path of page %s too, written to %s instead", ns.currentPage.ID, taken, owner, ns.files.FilePath)
+		}
+		ns.slugs.Claim(ns.pagePath(), ns.currentPage.ID)
+	}
+	for _, p := range []string{ns.files.FilePath, ns.files.MediaPath} {
+		if err := ns.checkInsideHome(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pagePath is the path of the current page without extension: a bundle folder, or a file
+// named the same as a folder has the same url
+func (ns *NotionSite) pagePath() string {
+	if name := filepath.Base(ns.files.FilePath); name == defaultMarkdownName || name == sectionMarkdownName {
+		return ns.files.FileFolderPath
+	}
+	return strings.TrimSuffix(ns.files.FilePath, filepath.Ext(ns.files.FilePath))
+}
+
+// setFilePaths sets the paths of the current page, suffix tells apart the pages of the same slug
+func (ns *NotionSite) setFilePaths(suffix string) {
+	ns.files.mediaFolderLink = ""
+	if ns.currentPageProp.IsCustomNameFile {
 		ns.files.FileName = ns.getFilename()
+		if suffix != "" {
+			ext := filepath.Ext(ns.files.FileName)
+			ns.files.FileName = strings.TrimSuffix(ns.files.FileName, ext) + "-" + suffix + ext
+		}
+		ns.files.Slug = strings.TrimSuffix(ns.files.FileName, filepath.Ext(ns.files.FileName))
 		ns.files.MediaPath = filepath.Join(ns.config.HomePath, ns.files.Position, mediaRelativePath)
 		ns.files.FileFolderPath = filepath.Join(ns.config.HomePath, ns.files.Position)
 		ns.files.FilePath = filepath.Join(ns.config.HomePath, ns.files.Position, ns.files.FileName)
-	} else {
-		ns.files.FileName = filepath.Join(ns.getArticleFolderPath(), defaultMarkdownName)
-		ns.files.MediaPath = filepath.Join(ns.config.HomePath, ns.files.Position, ns.getArticleFolderPath(), mediaRelativePath)
-		ns.files.FileFolderPath = filepath.Join(ns.config.HomePath, ns.files.Position, ns.getArticleFolderPath())
-		ns.files.FilePath = filepath.Join(ns.files.FileFolderPath, defaultMarkdownName)
+		ns.setPatternMediaPath()
+		return
+	}
+	slug := ns.pageSlug()
+	if suffix != "" {
+		slug += "-" + suffix
 	}
+	markdownName := defaultMarkdownName
+	if ns.currentPageProp.IsSection {
+		markdownName = sectionMarkdownName
+	}
+	articleFolderPath := ns.getArticleFolderPath(slug)
+	folderPath := filepath.Join(ns.config.HomePath, ns.files.Position, articleFolderPath)
+	if ns.currentPageProp.ParentFolder != "" {
+		folderPath = filepath.Join(ns.currentPageProp.ParentFolder, articleFolderPath)
+	}
+	ns.files.FileName = filepath.Join(articleFolderPath, markdownName)
+	ns.files.Slug = slug
+	ns.files.MediaPath = filepath.Join(folderPath, mediaRelativePath)
+	ns.files.FileFolderPath = folderPath
+	ns.files.FilePath = filepath.Join(ns.files.FileFolderPath, markdownName)
+	// child pages are nested in their parent whatever the pattern
+	if ns.paths != nil && ns.paths.page != nil && ns.currentPageProp.ParentFolder == "" {
+		if err := ns.setPatternPaths(slug); err != nil {
+			ns.warnPathf("page %s: %s, written to %s", ns.currentPage.ID, err, ns.files.FilePath)
+		}
+	}
+	ns.setPatternMediaPath()
 }
 
-func (files *Files) DownloadMedia(dynamicMedia any) error {
+// setPatternMediaPath moves the media folder of the current page after the media pattern, if any
+func (ns *NotionSite) setPatternMediaPath() {
+	if ns.paths == nil {
+		return
+	}
+	mediaPath := ns.files.MediaPath
+	if err := ns.setMediaPath(ns.files.Slug); err != nil {
+		ns.files.MediaPath, ns.files.mediaFolderLink = mediaPath, ""
+		ns.warnPathf("page %s: %s, the media files are written to %s", ns.currentPage.ID, err, mediaPath)
+	}
+}
 
-	download := func(imgURL string) (string, error) {
-		var savePath string
-		savePath = files.MediaPath
-		resp, err := http.Get(imgURL)
-		if err != nil {
-			return "", err
-		}
+// warnPathf warns about the paths of the current page once, not in both passes
+func (ns *NotionSite) warnPathf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if ns.pathWarnings[msg] {
+		return
+	}
+	if ns.pathWarnings == nil {
+		ns.pathWarnings = make(map[string]bool)
+	}
+	ns.pathWarnings[msg] = true
+	ns.report.Warnf("%s", msg)
+}
 
-		imgFilename, err := files.saveTo(resp.Body, imgURL, savePath)
+// download saves a file to the media folder of the page and returns its path relative to the page.
+// Files already in the media index are not fetched again.
+func (files *Files) download(mediaURL string, blockID string, expect string) (string, error) {
+	if files.Media == nil {
+		files.Media = LoadMediaIndex("")
+	}
+	key := mediaSourceKey(mediaURL)
+	entry := files.Media.Sources[key]
+	if entry == nil || !files.reuseMedia(entry) {
+		if files.Downloader == nil {
+			files.Downloader = NewDownloader(Downloads{})
+		}
+		var err error
+		entry, err = files.Downloader.Fetch(mediaURL, expect, func(body io.Reader, contentType string, check func(*MediaEntry) error) (*MediaEntry, error) {
+			return storeMedia(body, contentType, mediaURL, files.mediaDir(), check)
+		})
 		if err != nil {
 			return "", err
 		}
-		var convertWinPath = strings.ReplaceAll(filepath.Join(files.DefaultMediaFolderName, imgFilename), "\\", "/")
+		files.Media.Sources[key] = entry
+	}
+	if err := files.store(entry.File); err != nil {
+		return "", err
+	}
+	if blockID != "" {
+		files.Media.Blocks[normalizeID(blockID)] = entry.File
+	}
+	return files.mediaLink(entry.File), nil
+}
 
-		return convertWinPath, nil
+// storedFile is the file a media url was stored as, empty when it is not stored
+func (files *Files) storedFile(mediaURL string) string {
+	if files.Media == nil {
+		return ""
+	}
+	if entry := files.Media.Sources[mediaSourceKey(mediaURL)]; entry != nil {
+		return entry.File
 	}
+	return ""
+}
 
-	var err error
+// storedLink places a file stored before in the media folder of the page and links it, without
+// fetching it. It is empty when the url was never stored or its file is gone.
+func (files *Files) storedLink(mediaURL string) string {
+	if files.Media == nil {
+		return ""
+	}
+	entry := files.Media.Sources[mediaSourceKey(mediaURL)]
+	if entry == nil || !files.reuseMedia(entry) {
+		return ""
+	}
+	if err := files.store(entry.File); err != nil {
+		return ""
+	}
+	return files.mediaLink(entry.File)
+}
 
-	if blockTypeMediaBlocks(dynamicMedia) {
-		if reflect.TypeOf(dynamicMedia) == reflect.TypeOf(&notion.ImageBlock{}) {
-			media := dynamicMedia.(*notion.ImageBlock)
-			if media.Type == notion.FileTypeExternal {
-				media.External.URL, err = download(media.External.URL)
-			}
-			if media.Type == notion.FileTypeFile {
-				media.File.URL, err = download(media.File.URL)
-			}
-		}
-		if reflect.TypeOf(dynamicMedia) == reflect.TypeOf(&notion.FileBlock{}) {
-			media := dynamicMedia.(*notion.FileBlock)
-			if media.Type == notion.FileTypeExternal {
-				media.External.URL, err = download(media.External.URL)
-			}
-			if media.Type == notion.FileTypeFile {
-				media.File.URL, err = download(media.File.URL)
-			}
-		}
-		if reflect.TypeOf(dynamicMedia) == reflect.TypeOf(&notion.VideoBlock{}) {
-			media := dynamicMedia.(*notion.VideoBlock)
-			if media.Type == notion.FileTypeExternal {
-				media.External.URL, err = download(media.External.URL)
-			}
-			if media.Type == notion.FileTypeFile {
-				media.File.URL, err = download(media.File.URL)
-			}
-		}
-		if reflect.TypeOf(dynamicMedia) == reflect.TypeOf(&notion.PDFBlock{}) {
-			media := dynamicMedia.(*notion.PDFBlock)
-			if media.Type == notion.FileTypeExternal {
-				media.External.URL, err = download(media.External.URL)
-			}
-			if media.Type == notion.FileTypeFile {
-				media.File.URL, err = download(media.File.URL)
-			}
-		}
-		if reflect.TypeOf(dynamicMedia) == reflect.TypeOf(&notion.AudioBlock{}) {
-			media := dynamicMedia.(*notion.AudioBlock)
-			if media.Type == notion.FileTypeExternal {
-				media.External.URL, err = download(media.External.URL)
-			}
-			if media.Type == notion.FileTypeFile {
-				media.File.URL, err = download(media.File.URL)
-			}
+// mediaLink is the path of a stored file relative to the page, or its public url
+// when the media are published apart from the site
+func (files *Files) mediaLink(file string) string {
+	if files.publicLink != nil {
+		var link strings.Builder
+		if err := files.publicLink.Execute(&link, files.mediaLinkData(file)); err == nil {
+			return link.String()
 		}
 	}
-	return err
+	if link := files.storage().URL(file); link != "" {
+		return link
+	}
+	if files.mediaFolderLink != "" {
+		return path.Join(files.mediaFolderLink, file)
+	}
+	return strings.ReplaceAll(filepath.Join(files.DefaultMediaFolderName, file), "\\", "/")
+}
 
+func (files *Files) mediaLinkData(file string) mediaLinkData {
+	folder, err := filepath.Rel(files.HomePath, files.MediaPath)
+	if err != nil {
+		folder = files.DefaultMediaFolderName
+	}
+	if key := files.storage().Key(file); key != "" {
+		folder = strings.TrimPrefix(path.Dir(key), ".")
+	}
+	return mediaLinkData{
+		Position: files.Position,
+		Slug:     files.Slug,
+		Folder:   strings.ReplaceAll(folder, "\\", "/"),
+		File:     file,
+	}
 }
 
-func (files *Files) saveTo(reader io.Reader, rawURL, distDir string) (string, error) {
-	u, err := url.Parse(rawURL)
+// SetPublicLink links the media files to a public url: a base url the path of the file in the
+// home path is appended to, or a template of the url, e.g. https://cdn.example.com/{{.Position}}/{{.Slug}}/{{.File}}
+func (files *Files) SetPublicLink(link string) error {
+	if link == "" {
+		files.publicLink = nil
+		return nil
+	}
+	if !strings.Contains(link, "{{") {
+		link = strings.TrimRight(link, "/") + "/{{.Folder}}/{{.File}}"
+	}
+	tpl, err := template.New("imagePublicLink").Parse(link)
 	if err != nil {
-		return "", fmt.Errorf("malformed url: %s", err)
+		return fmt.Errorf("imagePublicLink: %s", err)
+	}
+	if err := tpl.Execute(io.Discard, mediaLinkData{}); err != nil {
+		return fmt.Errorf("imagePublicLink: %s", err)
 	}
+	files.publicLink = tpl
+	return nil
+}
 
-	// gen file name
-	splitPaths := strings.Split(u.Path, "/")
-	imageFilename := splitPaths[len(splitPaths)-1]
-	if strings.HasPrefix(imageFilename, "Untitled.") {
-		imageFilename = splitPaths[len(splitPaths)-2] + filepath.Ext(u.Path)
+func (files *Files) storage() MediaStorage {
+	if files.Storage == nil {
+		return LocalStorage{}
 	}
+	return files.Storage
+}
 
-	if err := os.MkdirAll(distDir, 0755); err != nil {
-		return "", fmt.Errorf("%s: %s", distDir, err)
+// mediaDir is the folder the media files are written to: the media folder of the page,
+// or the folder of the storage they are uploaded from
+func (files *Files) mediaDir() string {
+	if dir := files.storage().Dir(); dir != "" {
+		return dir
 	}
+	return files.MediaPath
+}
 
-	filename := fmt.Sprintf("%s_%s", u.Hostname(), imageFilename)
-	out, err := os.Create(filepath.Join(distDir, filename))
-	if err != nil {
-		return "", fmt.Errorf("couldn't create image file: %s", err)
+// store hands a file written to the media folder to the storage
+func (files *Files) store(file string) error {
+	contentType := typeByExtension(filepath.Ext(file))
+	if err := files.storage().Store(file, contentType); err != nil {
+		return fmt.Errorf("couldn't store %s: %s", file, err)
 	}
-	defer out.Close()
+	return nil
+}
 
-	_, err = io.Copy(out, reader)
-	return filename, err
+// reuseMedia places a stored file in the media folder of the page, copied from where it was written before
+func (files *Files) reuseMedia(entry *MediaEntry) bool {
+	target := filepath.Join(files.mediaDir(), entry.File)
+	if _, err := os.Stat(target); err == nil {
+		entry.Path = target
+		return true
+	}
+	if entry.Path == "" {
+		return false
+	}
+	if err := files.mkdirPath(files.mediaDir()); err != nil {
+		return false
+	}
+	if err := files.copyFile(entry.Path, target); err != nil {
+		os.Remove(target)
+		return false
+	}
+	entry.Path = target
+	return true
+}
+
+// DownloadMedia saves the files of a media block, a page cover or icon or a files property to the
+// media folder and links them there. A file which can't be downloaded is linked with the placeholder,
+// or keeps its url, and the error tells why.
+func (files *Files) DownloadMedia(media any) error {
+	var blockID string
+	if block, ok := media.(notion.Block); ok {
+		blockID = block.ID()
+	}
+	var errs []string
+	for _, mf := range mediaFiles(media) {
+		if *mf.url == "" {
+			continue
+		}
+		link, err := files.download(*mf.url, blockID, mf.expect)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("couldn't download %s: %s", mediaSourceKey(*mf.url), err))
+			if files.Placeholder != "" {
+				*mf.url = files.Placeholder
+			}
+			continue
+		}
+		*mf.url = link
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
 }
 
 func (files *Files) copyDir(src, dst string) error {
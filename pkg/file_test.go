@@ -0,0 +1,55 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestWriteFile checks a file is rewritten only when its content changes, its mtime kept otherwise
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.md")
+	for i, c := range []struct {
+		content string
+		changed bool
+	}{{"a", true}, {"a", false}, {"b", true}} {
+		var before time.Time
+		if _, err := os.Stat(path); err == nil {
+			before = time.Unix(0, 0)
+			if err := os.Chtimes(path, before, before); err != nil {
+				t.Fatal(err)
+			}
+		}
+		changed, err := writeFile(path, []byte(c.content))
+		if err != nil || changed != c.changed {
+			t.Fatalf("write %d: changed %t %v, want %t", i, changed, err, c.changed)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := os.ReadFile(path); string(got) != c.content {
+			t.Errorf("write %d: content %q, want %q", i, got, c.content)
+		}
+		if !c.changed && !info.ModTime().Equal(before) {
+			t.Errorf("write %d: unchanged file modified at %s", i, info.ModTime())
+		}
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("temporary files left: %v", entries)
+	}
+}
+
+// TestSettingFileName checks the setting files are named in lowercase with dashes, as hugo finds them
+func TestSettingFileName(t *testing.T) {
+	config := Config{Markdown: Markdown{HomePath: "site"}}
+	ns := NewNotionSite(nil, New(), NewFiles(config), config, nil)
+	for name, want := range map[string]string{"Config.toml": "config.toml", " My Params.yaml": "my-params.yaml"} {
+		ns.currentPageProp = &NotionProp{FileName: name, Types: "setting"}
+		ns.currentPageProp.IsSettingFile = ns.currentPageProp.IsSetting()
+		if got := ns.getFilename(); got != want {
+			t.Errorf("%q: got %q, want %q", name, got, want)
+		}
+	}
+}
@@ -1,10 +1,12 @@
 package pkg
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/dstotijn/go-notion"
 	"log"
 	"os"
+	"path/filepath"
 )
 
 type NotionSite struct {
@@ -16,10 +18,43 @@ type NotionSite struct {
 	currentPageProp *NotionProp
 	currentBlocks   []notion.Block
 	caches          []*NotionCache
+	links           *PageLinks
+	report          *Report
+	databases       map[string]*InlineDatabase
+	slugs           *Slugger
+	// paths are the path patterns of the pages, nil for the default layout
+	paths *pathPatterns
+	// pathWarnings are the warnings given about the paths of the pages, which are set twice:
+	// to register the links of the pages, then to generate them
+	pathWarnings map[string]bool
+}
+
+// sitePage is a page to publish with its blocks tree
+type sitePage struct {
+	page   notion.Page
+	blocks []notion.Block
+	// parent is the page a child page is nested in, nil for database pages
+	parent *sitePage
+	// weight orders a child page among its siblings
+	weight int
+	// folder is the output folder of the page, known once its file info is set
+	folder string
+	// children is the number of child pages, a page with children is a section
+	children int
+	// container is the folder page whose child database holds the page, nil for the others
+	container *NotionProp
 }
 
 func NewNotionSite(api *NotionAPI, tm *ToMarkdown, files *Files, config Config, caches []*NotionCache) *NotionSite {
-	return &NotionSite{api: api, tm: tm, files: files, config: config, caches: caches}
+	links := NewPageLinks(config.Markdown)
+	report := NewReport()
+	tm.Links = links
+	tm.Report = report
+	tm.Config = config.Markdown
+	databases := make(map[string]*InlineDatabase)
+	tm.Databases = databases
+	return &NotionSite{api: api, tm: tm, files: files, config: config, caches: caches, links: links, report: report, databases: databases,
+		slugs: NewSlugger(config.Slug), pathWarnings: make(map[string]bool)}
 }
 
 func Run(ns *NotionSite) error {
@@ -27,14 +62,72 @@ func Run(ns *NotionSite) error {
 	if err := ns.files.mkdirHomePath(); err != nil {
 		return fmt.Errorf("couldn't create content folder: %s", err)
 	}
-	// find and process database page
-	processDatabase(ns, ns.config.DatabaseID)
-	for _, cache := range ns.caches {
+	embeds, err := NewEmbedProviders(ns.config.Embeds)
+	if err != nil {
+		return err
+	}
+	ns.tm.Embeds = embeds
+	storage, err := NewMediaStorage(ns.config.Storage)
+	if err != nil {
+		return err
+	}
+	ns.files.Storage = storage
+	if err := ns.files.SetPublicLink(ns.config.ImagePublicLink); err != nil {
+		return err
+	}
+	if err := checkSummaryBreak(ns.config.Summary); err != nil {
+		return err
+	}
+	if err := checkChildDatabases(ns.config.ChildDatabase); err != nil {
+		return err
+	}
+	if ns.paths, err = newPathPatterns(ns.config.Markdown, ns.slugs); err != nil {
+		return err
+	}
+	ns.tm.OpenGraph = NewOpenGraphCache(ns.config.Bookmark)
+	// first pass: fetch every page to publish so links between them can be resolved
+	pages, err := collectPages(ns, ns.config.DatabaseID)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(ns.caches); i++ {
 		//ns.files.MediaPath = cache.ParentFilesInfo.MediaPath
-		if err := processDatabase(ns, cache.ChildDatabaseId); err != nil {
-			fmt.Errorf("process child database erro but continu %s", err)
+		childPages, err := collectPages(ns, ns.caches[i].ChildDatabaseId)
+		if err != nil {
+			log.Printf("process child database error but continue: %s\n", err)
+			continue
 		}
+		for _, p := range childPages {
+			if p.parent == nil {
+				p.container = ns.caches[i].ParentPropInfo
+			}
+		}
+		pages = append(pages, childPages...)
 	}
+	registerLinks(ns, pages)
+
+	// second pass: generate the pages
+	for i, p := range pages {
+		fmt.Printf("-- Article [%d/%d] -- %s \n", i+1, len(pages), p.page.URL)
+		// Generate content to file
+		if err := generate(ns, p); err != nil {
+			fmt.Println("❌ Generating blog post:", err)
+			continue
+		}
+		fmt.Println("✔ Generating blog post: Completed")
+		// child pages have no status to change
+		if p.parent != nil {
+			continue
+		}
+		// Change status of blog post if desired
+		if ns.api.changeStatus(ns.api.Client, p.page, ns.config.Notion) {
+			//changed++
+		}
+	}
+	if err := ns.files.Media.Save(); err != nil {
+		ns.report.Warnf("couldn't save the media index: %s", err)
+	}
+	ns.report.Print()
 	// Set GITHUB_ACTIONS info variables : https://docs.github.com/en/actions/learn-github-actions/workflow-commands-for-github-actions
 	if os.Getenv("GITHUB_ACTIONS") == "true" {
 		fmt.Printf("::set-output name=articles_published::\n")
@@ -42,21 +135,32 @@ func Run(ns *NotionSite) error {
 	return nil
 }
 
-func generate(ns *NotionSite, page notion.Page, blocks []notion.Block) error {
+// registerLinks records the output location of every page to publish
+func registerLinks(ns *NotionSite, pages []*sitePage) {
+	for _, p := range pages {
+		if err := initNotionSite(ns, p); err != nil {
+			ns.report.Warnf("%s, not published", err)
+			continue
+		}
+		if ns.currentPageProp.IsSettingFile || ns.currentPageProp.IsFolder() {
+			continue
+		}
+		filePath, err := filepath.Rel(ns.config.HomePath, ns.files.FilePath)
+		if err != nil {
+			continue
+		}
+		ns.links.Add(p.page.ID, &PageLink{
+			Title:    ns.currentPageProp.GetTitle(),
+			FilePath: filepath.ToSlash(filePath),
+			Anchors:  ns.tm.Anchors,
+		})
+	}
+}
+
+func generate(ns *NotionSite, p *sitePage) error {
 	// Generate markdown content to the file
-	initNotionSite(ns, page, blocks)
-
-	if ns.api.CheckHasChildDataBase(blocks, func(b bool, id string) {
-		// cache child database block id
-		if b {
-			ns.caches = append(ns.caches, &NotionCache{
-				ParentFilesInfo: ns.files,
-				ParentPropInfo:  ns.currentPageProp,
-				ChildDatabaseId: id,
-			})
-		}
-	}) {
-		return nil
+	if err := initNotionSite(ns, p); err != nil {
+		return err
 	}
 
 	ns.files.mkdirPath(ns.files.FileFolderPath)
@@ -65,48 +169,88 @@ func generate(ns *NotionSite, page notion.Page, blocks []notion.Block) error {
 		ns.tm.ContentTemplate = ns.config.Template
 		ns.tm.WithFrontMatter(ns.currentPage)
 	}
-	var err error
-	// save current io
-	if !ns.currentPageProp.IsFolder() {
-		ns.files.currentWriter, err = os.Create(ns.files.FilePath)
+	// the page is rendered in memory, a failed render leaves the file as it was and
+	// nothing of it in the buffer of the next page
+	ns.tm.ContentBuffer.Reset()
+	var content bytes.Buffer
+	ns.files.currentWriter = &content
+	if err := ns.tm.GenerateTo(ns); err != nil {
+		return err
 	}
-
+	if ns.currentPageProp.IsFolder() {
+		return nil
+	}
+	changed, err := writeFile(ns.files.FilePath, content.Bytes())
 	if err != nil {
-		return fmt.Errorf("error create file: %s", err)
+		return fmt.Errorf("error write file: %s", err)
 	}
+	ns.report.Written(ns.relativePath(ns.files.FilePath), changed)
+	return nil
+}
 
-	// todo edit frontMatter
-	//if ns.config.Markdown.ShortcodeSyntax != "" {
-	//	ns.tm.EnableExtendedSyntax(ns.config.Markdown.ShortcodeSyntax)
-	//}
-
-	//// todo how to support mention feature ???
-
-	return ns.tm.GenerateTo(ns)
+// relativePath is a path in the home path as it is reported
+func (ns *NotionSite) relativePath(p string) string {
+	if rel, err := filepath.Rel(ns.config.HomePath, p); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return p
 }
 
-func initNotionSite(ns *NotionSite, page notion.Page, blocks []notion.Block) {
+// initNotionSite sets the page as the current one, it fails for a page written where it can't be
+func initNotionSite(ns *NotionSite, p *sitePage) error {
+	page, blocks := p.page, p.blocks
 	// set current origin page
 	ns.currentPage = page
-	// set current notion page prop
-	ns.currentPageProp = NewNotionProp(ns.currentPage)
-	ns.SetFileInfo(ns.currentPageProp.Position)
+	// set current notion page prop, child pages are nested in the folder of their parent
+	if p.parent != nil {
+		ns.currentPageProp = NewChildNotionProp(page, NewNotionProp(p.parent.page), p.weight)
+		ns.currentPageProp.ParentFolder = p.parent.folder
+	} else {
+		ns.currentPageProp = NewNotionProp(ns.currentPage)
+	}
+	ns.currentPageProp.IsSection = p.children > 0
+	err := ns.SetFileInfo(ns.currentPageProp.Position)
+	// the child pages of a page out of the home path are out of it too
+	p.folder = ns.files.FileFolderPath
+	if err != nil {
+		return err
+	}
 	// set notion site files info
 	ns.tm.NotionProps = ns.currentPageProp
 	ns.tm.Files = ns.files
+	// the trail is the sections of the position, then the folder page and the parent pages
+	var parents []Crumb
+	for parent := p.parent; parent != nil; parent = parent.parent {
+		prop := NewNotionProp(parent.page)
+		parents = append([]Crumb{{ID: parent.page.ID, Title: prop.GetTitle(), Folder: prop.IsFolder()}}, parents...)
+	}
+	ns.tm.Trail = sectionCrumbs(ns.currentPageProp.Position)
+	top := p
+	for top.parent != nil {
+		top = top.parent
+	}
+	if top.container != nil {
+		ns.tm.Trail = append(ns.tm.Trail, Crumb{Title: top.container.GetTitle(), Folder: true})
+	}
+	ns.tm.Trail = append(ns.tm.Trail, parents...)
+	// heading anchors are computed up front so the toc and links can point to headings below them
+	ns.tm.Anchors = NewAnchors()
+	ns.tm.Anchors.Collect(blocks)
 	ns.currentBlocks = blocks
+	return nil
 }
 
-func processDatabase(ns *NotionSite, id string) error {
+// collectPages queries a database and fetches the blocks tree of its pages.
+// Pages holding a child database are not published, their child database is queued instead.
+func collectPages(ns *NotionSite, id string) ([]*sitePage, error) {
 	q, err := ns.api.queryDatabase(ns.api.Client, ns.config.Notion, id)
 	if err != nil {
-		return fmt.Errorf("❌ Querying Notion database: %s", err)
+		return nil, fmt.Errorf("❌ Querying Notion database: %s", err)
 	}
 	fmt.Println("✔ Querying Notion database: Completed")
-	// fetch page children
-	//changed = 0 // number of article status changed
+	var pages []*sitePage
 	for i, page := range q.Results {
-		fmt.Printf("-- Article [%d/%d] -- %s \n", i+1, len(q.Results), page.URL)
+		fmt.Printf("-- Fetching [%d/%d] -- %s \n", i+1, len(q.Results), page.URL)
 		// Get page blocks tree
 		blocks, err := ns.api.queryBlockChildren(ns.api.Client, page.ID)
 		if err != nil {
@@ -115,16 +259,102 @@ func processDatabase(ns *NotionSite, id string) error {
 		}
 		fmt.Println("✔ Getting blocks tree: Completed")
 
-		// Generate content to file
-		if err := generate(ns, page, blocks); err != nil {
-			fmt.Println("❌ Generating blog post:", err)
+		// the child database of a folder page holds more pages to publish, others are rendered in place
+		container := NewNotionProp(page).IsFolder() || ns.config.ChildDatabase.Containers
+		if container && ns.api.CheckHasChildDataBase(blocks, func(b bool, id string) {
+			// cache child database block id
+			if b {
+				ns.caches = append(ns.caches, &NotionCache{
+					ParentFilesInfo: ns.files,
+					ParentPropInfo:  NewNotionProp(page),
+					ChildDatabaseId: id,
+				})
+			}
+		}) {
 			continue
 		}
-		fmt.Println("✔ Generating blog post: Completed")
-		// Change status of blog post if desired
-		if ns.api.changeStatus(ns.api.Client, page, ns.config.Notion) {
-			//changed++
+		fetchInlineDatabases(ns, blocks)
+		warnPageDatabases(ns, page, blocks)
+		p := &sitePage{page: page, blocks: blocks}
+		pages = append(pages, p)
+		pages = append(pages, collectChildPages(ns, p)...)
+	}
+	return pages, nil
+}
+
+// collectChildPages fetches the child pages found in the blocks tree of a page, and theirs.
+// They follow their parent so its folder is known when they are placed below it.
+func collectChildPages(ns *NotionSite, parent *sitePage) []*sitePage {
+	var pages []*sitePage
+	for _, child := range findChildPages(parent.blocks) {
+		page, err := ns.api.queryPage(ns.api.Client, child.ID())
+		if err != nil {
+			ns.report.Warnf("couldn't fetch child page %s: %s", child.Title, err)
+			continue
 		}
+		blocks, err := ns.api.queryBlockChildren(ns.api.Client, page.ID)
+		if err != nil {
+			ns.report.Warnf("couldn't fetch the blocks of child page %s: %s", child.Title, err)
+			continue
+		}
+		fmt.Printf("✔ Fetching child page %s: Completed\n", child.Title)
+		fetchInlineDatabases(ns, blocks)
+		parent.children++
+		p := &sitePage{page: page, blocks: blocks, parent: parent, weight: parent.children}
+		pages = append(pages, p)
+		pages = append(pages, collectChildPages(ns, p)...)
+	}
+	return pages
+}
+
+// findChildPages returns the child page blocks of a blocks tree, in document order
+func findChildPages(blocks []notion.Block) []*notion.ChildPageBlock {
+	var children []*notion.ChildPageBlock
+	for _, block := range blocks {
+		if child, ok := block.(*notion.ChildPageBlock); ok {
+			children = append(children, child)
+			continue
+		}
+		children = append(children, findChildPages(blockChildren(block))...)
+	}
+	return children
+}
+
+// warnPageDatabases warns about the child databases of a page rendered in place whose rows look
+// like the pages of the site, they have its filter property: they were published before
+func warnPageDatabases(ns *NotionSite, page notion.Page, blocks []notion.Block) {
+	if ns.config.Notion.FilterProp == "" {
+		return
+	}
+	for _, block := range blocks {
+		db, ok := ns.databases[normalizeID(block.ID())]
+		if _, isDatabase := block.(*notion.ChildDatabaseBlock); !isDatabase || !ok {
+			continue
+		}
+		for _, row := range db.Rows {
+			if props, _ := row.Properties.(notion.DatabasePageProperties); props != nil {
+				if _, ok := props[ns.config.Notion.FilterProp]; ok {
+					ns.report.Warnf("page %s renders its child database %s as a table, its rows have the %s property of pages: "+
+						"set its Type to folder, or childDatabase.containers, to publish them", page.URL, db.Title, ns.config.Notion.FilterProp)
+					break
+				}
+			}
+		}
+	}
+}
+
+// fetchInlineDatabases queries the child databases found in the blocks tree
+func fetchInlineDatabases(ns *NotionSite, blocks []notion.Block) {
+	for _, block := range blocks {
+		if _, ok := block.(*notion.ChildDatabaseBlock); ok {
+			db, err := ns.api.queryChildDatabase(ns.api.Client, block.ID(), ns.config.ChildDatabase)
+			if err != nil {
+				ns.report.Warnf("couldn't query child database %s: %s", block.ID(), err)
+				continue
+			}
+			fmt.Printf("✔ Querying child database %s: %d rows\n", db.Title, len(db.Rows))
+			ns.databases[normalizeID(block.ID())] = db
+		}
+		fetchInlineDatabases(ns, blockChildren(block))
 	}
-	return nil
 }
@@ -0,0 +1,170 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+)
+
+// testPage is a database page with a title and paragraphs
+func testPage(t *testing.T, id string, title string, paragraphs ...string) *sitePage {
+	var page notion.Page
+	if err := json.Unmarshal([]byte(fmt.Sprintf(`{"object":"page","id":%q,"created_time":"2022-06-05T10:00:00Z",
+		"parent":{"type":"database_id","database_id":"d"},
+		"properties":{"Name":{"id":"title","type":"title","title":[{"type":"text","text":{"content":%q},"plain_text":%q}]}}}`,
+		id, title, title)), &page); err != nil {
+		t.Fatal(err)
+	}
+	var results []string
+	for i, text := range paragraphs {
+		results = append(results, fmt.Sprintf(`{"object":"block","id":"%s-%d","type":"paragraph",
+			"paragraph":{"rich_text":[{"type":"text","text":{"content":%q},"plain_text":%q}]}}`, id, i, text, text))
+	}
+	var resp notion.BlockChildrenResponse
+	if err := json.Unmarshal([]byte(`{"results":[`+strings.Join(results, ",")+`]}`), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return &sitePage{page: page, blocks: resp.Results}
+}
+
+// testChildPage is a child page of parent, its blocks the paragraphs then a child page block for each of children
+func testChildPage(t *testing.T, parent *sitePage, id string, title string, paragraph string, children ...string) *sitePage {
+	var page notion.Page
+	if err := json.Unmarshal([]byte(fmt.Sprintf(`{"object":"page","id":%q,"created_time":"2022-06-06T10:00:00Z",
+		"parent":{"type":"page_id","page_id":%q},
+		"properties":{"title":{"id":"title","type":"title","title":[{"type":"text","text":{"content":%q},"plain_text":%q}]}}}`,
+		id, parent.page.ID, title, title)), &page); err != nil {
+		t.Fatal(err)
+	}
+	parent.children++
+	p := &sitePage{page: page, blocks: testPage(t, id, title, paragraph).blocks, parent: parent, weight: parent.children}
+	addChildPageBlocks(t, p, children...)
+	return p
+}
+
+// addChildPageBlocks appends a child page block of each id and title pair to the blocks of the page
+func addChildPageBlocks(t *testing.T, p *sitePage, children ...string) {
+	for i := 0; i+1 < len(children); i += 2 {
+		var resp notion.BlockChildrenResponse
+		if err := json.Unmarshal([]byte(fmt.Sprintf(`{"results":[{"object":"block","id":%q,"type":"child_page","child_page":{"title":%q}}]}`,
+			children[i], children[i+1])), &resp); err != nil {
+			t.Fatal(err)
+		}
+		p.blocks = append(p.blocks, resp.Results...)
+	}
+}
+
+// TestGenerateChildPages checks the child pages are nested in the folder of their parent, a page
+// with child pages is a section linking them. The written files are compared with
+// testdata/pages/child_pages.golden, run with -update to rewrite it.
+func TestGenerateChildPages(t *testing.T) {
+	const (
+		guide   = "11111111-1111-1111-1111-111111111111"
+		install = "22222222-2222-2222-2222-222222222222"
+		linux   = "33333333-3333-3333-3333-333333333333"
+		usage   = "44444444-4444-4444-4444-444444444444"
+	)
+	dir := t.TempDir()
+	config := Config{Markdown: Markdown{HomePath: dir}}
+	ns := NewNotionSite(nil, New(), NewFiles(config), config, nil)
+
+	parent := testPage(t, guide, "Guide", "Intro text")
+	addChildPageBlocks(t, parent, install, "Install", usage, "Usage")
+	installPage := testChildPage(t, parent, install, "Install", "Install text", linux, "Linux")
+	pages := []*sitePage{
+		parent,
+		installPage,
+		testChildPage(t, installPage, linux, "Linux", "Linux text"),
+		testChildPage(t, parent, usage, "Usage", "Usage text"),
+	}
+	registerLinks(ns, pages)
+	for _, p := range pages {
+		if err := generate(ns, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got bytes.Buffer
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		fmt.Fprintf(&got, "-- %s --\n%s", filepath.ToSlash(rel), raw)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", "pages", "child_pages.golden")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(golden, got.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != string(want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got.String(), want)
+	}
+}
+
+// TestGenerateAfterFailure checks nothing of a page which fails to render is written to the next one
+func TestGenerateAfterFailure(t *testing.T) {
+	dir := t.TempDir()
+	config := Config{Markdown: Markdown{HomePath: dir}}
+	ns := NewNotionSite(nil, New(), NewFiles(config), config, nil)
+
+	ns.config.Template = filepath.Join(dir, "missing.tpl")
+	if err := generate(ns, testPage(t, "aaaaaaaa-1111", "Broken", "broken text")); err == nil {
+		t.Fatal("no error for a missing content template")
+	}
+	ns.config.Template = ""
+	if err := generate(ns, testPage(t, "bbbbbbbb-2222", "Clean", "clean text")); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(ns.files.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "broken text") || !strings.Contains(string(raw), "clean text") {
+		t.Errorf("got %s", raw)
+	}
+}
+
+// TestPathWarningsOnce checks a path pattern which fails for a page is warned once, not in both passes
+func TestPathWarningsOnce(t *testing.T) {
+	config := Config{Markdown: Markdown{
+		HomePath:     t.TempDir(),
+		PathPattern:  "{{with .Props.Name}}{{.Missing}}{{end}}/{{.Slug}}.md",
+		MediaPattern: "{{with .Props.Name}}{{.Missing}}{{end}}/media",
+	}}
+	ns := NewNotionSite(nil, New(), NewFiles(config), config, nil)
+	var err error
+	if ns.paths, err = newPathPatterns(ns.config.Markdown, ns.slugs); err != nil {
+		t.Fatal(err)
+	}
+	page := testPage(t, "cccccccc-3333", "Patterned", "text")
+	registerLinks(ns, []*sitePage{page})
+	if err := generate(ns, page); err != nil {
+		t.Fatal(err)
+	}
+	if len(ns.report.Warnings) != 2 {
+		t.Errorf("got the warnings %q, want one of the page path and one of the media path", ns.report.Warnings)
+	}
+}
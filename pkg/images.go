@@ -0,0 +1,248 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultImageMaxWidth = 1600
+	defaultImageQuality  = 82
+)
+
+// ImageVariant is a copy of an image at a smaller width
+type ImageVariant struct {
+	File   string `json:"file"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Size   int64  `json:"size"`
+}
+
+// ImageInfo is what the image pipeline made of a stored image
+type ImageInfo struct {
+	// Width and Height of the largest copy, the one the page shows
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// Options are the settings the image was processed with, it is processed again when they change
+	Options string `json:"options"`
+	// Variants are the copies in the format of the image, by width. The last one is the largest.
+	Variants []ImageVariant `json:"variants"`
+	// WebP are the webp copies at the same widths, when they are smaller
+	WebP []ImageVariant `json:"webp,omitempty"`
+}
+
+func (config Images) withDefaults() Images {
+	if config.MaxWidth <= 0 {
+		config.MaxWidth = defaultImageMaxWidth
+	}
+	if config.Quality <= 0 || config.Quality > 100 {
+		config.Quality = defaultImageQuality
+	}
+	return config
+}
+
+func (config Images) options() string {
+	return fmt.Sprintf("max=%d quality=%d widths=%v webp=%t", config.MaxWidth, config.Quality, config.Widths, config.WebP)
+}
+
+// widths are the widths of the copies of an image as wide as width: the srcset widths below it then the max width
+func (config Images) widths(width int) []int {
+	largest := width
+	if largest > config.MaxWidth {
+		largest = config.MaxWidth
+	}
+	widths := []int{largest}
+	seen := map[int]bool{largest: true}
+	for _, w := range config.Widths {
+		if w > 0 && w < largest && !seen[w] {
+			seen[w] = true
+			widths = append(widths, w)
+		}
+	}
+	sort.Ints(widths)
+	return widths
+}
+
+// ProcessImage scales a stored jpeg or png image down to the widths of the config and
+// re-encodes it, next to it in the media folder. Other images are left as they are: nil info.
+func (files *Files) ProcessImage(file string, config Images) (*ImageInfo, error) {
+	config = config.withDefaults()
+	if files.Media == nil {
+		files.Media = LoadMediaIndex("")
+	}
+	if info := files.Media.Images[file]; info != nil && info.Options == config.options() && files.hasImageVariants(info) {
+		return info, files.storeImage(info)
+	}
+	source := filepath.Join(files.mediaDir(), file)
+	raw, err := os.ReadFile(source)
+	if err != nil {
+		return nil, err
+	}
+	img, format, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode image %s: %s", file, err)
+	}
+	if format != "jpeg" && format != "png" {
+		return nil, nil
+	}
+
+	// scaled in premultiplied alpha, the transparent pixels don't bleed their color
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+	base := strings.TrimSuffix(file, filepath.Ext(file))
+	info := &ImageInfo{Options: config.options()}
+	for _, width := range config.widths(b.Dx()) {
+		height := int(math.Round(float64(b.Dy()) * float64(width) / float64(b.Dx())))
+		if height < 1 {
+			height = 1
+		}
+		scaled := rgba
+		if width != b.Dx() {
+			scaled = resizeImage(rgba, width, height)
+		}
+
+		var buf bytes.Buffer
+		if format == "jpeg" {
+			err = jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: config.Quality})
+		} else {
+			err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, scaled)
+		}
+		if err != nil {
+			return nil, err
+		}
+		variant := ImageVariant{File: fmt.Sprintf("%s-%d%s", base, width, filepath.Ext(file)), Width: width, Height: height}
+		// a re-encoded full size copy bigger than the image is no use
+		if width == b.Dx() && buf.Len() >= len(raw) {
+			variant.File, variant.Size = file, int64(len(raw))
+		} else if variant.Size, err = files.writeMedia(variant.File, buf.Bytes()); err != nil {
+			return nil, err
+		}
+		info.Variants = append(info.Variants, variant)
+
+		if config.WebP {
+			buf.Reset()
+			if err := encodeWebP(&buf, scaled); err != nil {
+				return nil, err
+			}
+			webp := ImageVariant{File: fmt.Sprintf("%s-%d.webp", base, width), Width: width, Height: height}
+			if webp.Size, err = files.writeMedia(webp.File, buf.Bytes()); err != nil {
+				return nil, err
+			}
+			info.WebP = append(info.WebP, webp)
+		}
+	}
+	largest := info.Variants[len(info.Variants)-1]
+	info.Width, info.Height = largest.Width, largest.Height
+	// the webp copies are lossless, photos are smaller as jpeg
+	if len(info.WebP) > 0 && info.WebP[len(info.WebP)-1].Size >= largest.Size {
+		for _, webp := range info.WebP {
+			os.Remove(filepath.Join(files.mediaDir(), webp.File))
+		}
+		info.WebP = nil
+	}
+	files.Media.Images[file] = info
+	return info, files.storeImage(info)
+}
+
+func (files *Files) storeImage(info *ImageInfo) error {
+	for _, variant := range append(append([]ImageVariant{}, info.Variants...), info.WebP...) {
+		if err := files.store(variant.File); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (files *Files) hasImageVariants(info *ImageInfo) bool {
+	for _, variant := range append(append([]ImageVariant{}, info.Variants...), info.WebP...) {
+		if _, err := os.Stat(filepath.Join(files.mediaDir(), variant.File)); err != nil {
+			return false
+		}
+	}
+	return len(info.Variants) > 0
+}
+
+func (files *Files) writeMedia(file string, data []byte) (int64, error) {
+	if err := files.mkdirPath(files.mediaDir()); err != nil {
+		return 0, err
+	}
+	return int64(len(data)), os.WriteFile(filepath.Join(files.mediaDir(), file), data, 0644)
+}
+
+// srcset lists the copies with their widths: media/a-480.jpg 480w, media/a-960.jpg 960w
+func (files *Files) srcset(variants []ImageVariant) string {
+	var srcs []string
+	for _, variant := range variants {
+		srcs = append(srcs, fmt.Sprintf("%s %dw", files.mediaLink(variant.File), variant.Width))
+	}
+	return strings.Join(srcs, ", ")
+}
+
+// imageWeight is the share of a source pixel in a scaled pixel
+type imageWeight struct {
+	index  int
+	weight float32
+}
+
+// boxWeights are the source pixels each scaled pixel covers, by how much it covers them
+func boxWeights(src, dst int) [][]imageWeight {
+	scale := float64(src) / float64(dst)
+	weights := make([][]imageWeight, dst)
+	for i := range weights {
+		start, end := float64(i)*scale, float64(i+1)*scale
+		for j := int(start); j < src && float64(j) < end; j++ {
+			if w := math.Min(end, float64(j+1)) - math.Max(start, float64(j)); w > 0 {
+				weights[i] = append(weights[i], imageWeight{j, float32(w / scale)})
+			}
+		}
+	}
+	return weights
+}
+
+// resizeImage scales an image down by averaging the pixels each scaled pixel covers,
+// the rows first then the columns
+func resizeImage(src *image.RGBA, width, height int) *image.RGBA {
+	srcW, srcH := src.Rect.Dx(), src.Rect.Dy()
+	xWeights, yWeights := boxWeights(srcW, width), boxWeights(srcH, height)
+	rows := make([]float32, srcH*width*4)
+	for y := 0; y < srcH; y++ {
+		line := src.Pix[y*src.Stride:]
+		for x, weights := range xWeights {
+			var sum [4]float32
+			for _, w := range weights {
+				p := line[w.index*4 : w.index*4+4]
+				for c := range sum {
+					sum[c] += float32(p[c]) * w.weight
+				}
+			}
+			copy(rows[(y*width+x)*4:], sum[:])
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y, weights := range yWeights {
+		for x := 0; x < width; x++ {
+			var sum [4]float32
+			for _, w := range weights {
+				p := rows[(w.index*width+x)*4:]
+				for c := range sum {
+					sum[c] += p[c] * w.weight
+				}
+			}
+			for c, v := range sum {
+				dst.Pix[y*dst.Stride+x*4+c] = uint8(math.Min(255, math.Max(0, math.Round(float64(v)))))
+			}
+		}
+	}
+	return dst
+}
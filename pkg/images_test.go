@@ -0,0 +1,93 @@
+package pkg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// TestEncodeWebP checks the lossless webp copies decode to the same pixels
+func TestEncodeWebP(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		img  *image.RGBA
+	}{
+		{"1x1", fillImage(1, 1, func(int, int) color.RGBA { return color.RGBA{10, 20, 30, 255} })},
+		{"flat", fillImage(64, 64, func(int, int) color.RGBA { return color.RGBA{200, 100, 50, 255} })},
+		{"odd", fillImage(37, 13, func(x, y int) color.RGBA { return color.RGBA{uint8(x * 7), uint8(y * 19), uint8(x * y), 255} })},
+		{"alpha", fillImage(23, 17, func(x, y int) color.RGBA {
+			a := uint8(x * 11)
+			return color.RGBA{a / 2, a / 3, a, a}
+		})},
+		{"noise", fillImage(50, 31, func(x, y int) color.RGBA {
+			v := uint32(x*2654435761) ^ uint32(y*40503)
+			return color.RGBA{uint8(v), uint8(v >> 8), uint8(v >> 16), 255}
+		})},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := encodeWebP(&buf, c.img); err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := webp.Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Bounds() != c.img.Bounds() {
+				t.Fatalf("bounds %v, want %v", decoded.Bounds(), c.img.Bounds())
+			}
+			b := c.img.Bounds()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					if got, want := color.NRGBAModel.Convert(decoded.At(x, y)), color.NRGBAModel.Convert(c.img.At(x, y)); got != want {
+						t.Fatalf("pixel %d,%d: %v, want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestProcessImage checks the copies of an image at the srcset widths and the max width
+func TestProcessImage(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, fillImage(300, 200, func(x, y int) color.RGBA { return color.RGBA{uint8(x), uint8(y), 0, 255} })); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.png"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	files := &Files{MediaPath: dir, DefaultMediaFolderName: "media"}
+	info, err := files.ProcessImage("a.png", Images{MaxWidth: 240, Widths: []int{100, 480}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Width != 240 || info.Height != 160 || len(info.Variants) != 2 {
+		t.Fatalf("got %dx%d %+v, want 240x160 in 2 copies", info.Width, info.Height, info.Variants)
+	}
+	for i, want := range []image.Point{{100, 67}, {240, 160}} {
+		variant := info.Variants[i]
+		f, err := os.Open(filepath.Join(dir, variant.File))
+		if err != nil {
+			t.Fatal(err)
+		}
+		config, _, err := image.DecodeConfig(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (image.Point{config.Width, config.Height}) != want || variant.Width != want.X || variant.Height != want.Y {
+			t.Errorf("copy %s: %dx%d, want %v", variant.File, config.Width, config.Height, want)
+		}
+	}
+	if got, want := files.srcset(info.Variants), "media/a-100.png 100w, media/a-240.png 240w"; got != want {
+		t.Errorf("srcset %q, want %q", got, want)
+	}
+}
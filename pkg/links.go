@@ -0,0 +1,200 @@
+package pkg
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	linkStyleRelref   = "relref"
+	linkStyleRelative = "relative"
+
+	unpublishedLinkNotion = "notion"
+	unpublishedLinkText   = "text"
+
+	contentDir = "content"
+)
+
+var regexNotionID = regexp.MustCompile(`[0-9a-fA-F]{32}$`)
+
+// PageLink is where a published notion page ends up in the site
+type PageLink struct {
+	Title string
+	// FilePath is the markdown file relative to the home path, slash separated
+	FilePath string
+	Anchors  *Anchors
+}
+
+// Crumb is a section or a page above the current one in the exported hierarchy
+type Crumb struct {
+	ID    string
+	Title string
+	// Section is the folder of a section in the home path, e.g. content/post
+	Section string
+	// Folder is a folder page, it has no page of its own to link
+	Folder bool
+}
+
+// sectionCrumbs are the sections of a position in the content folder: content/post/tech is post then tech
+func sectionCrumbs(position string) []Crumb {
+	rel := strings.Trim(filepath.ToSlash(filepath.Clean(position)), "/")
+	if !strings.HasPrefix(rel, contentDir+"/") {
+		return nil
+	}
+	var crumbs []Crumb
+	section := contentDir
+	for _, name := range strings.Split(strings.TrimPrefix(rel, contentDir+"/"), "/") {
+		section = path.Join(section, name)
+		crumbs = append(crumbs, Crumb{Title: name, Section: section})
+	}
+	return crumbs
+}
+
+// PageLinks maps the id of every page being published to its output location
+type PageLinks struct {
+	pages           map[string]*PageLink
+	style           string
+	unpublishedLink string
+}
+
+func NewPageLinks(config Markdown) *PageLinks {
+	links := &PageLinks{
+		pages:           make(map[string]*PageLink),
+		style:           config.LinkStyle,
+		unpublishedLink: config.UnpublishedLink,
+	}
+	if links.style == "" {
+		links.style = linkStyleRelref
+	}
+	if links.unpublishedLink == "" {
+		links.unpublishedLink = unpublishedLinkNotion
+	}
+	return links
+}
+
+func (pl *PageLinks) Add(pageID string, link *PageLink) {
+	pl.pages[normalizeID(pageID)] = link
+}
+
+func (pl *PageLinks) Get(pageID string) *PageLink {
+	if pl == nil {
+		return nil
+	}
+	return pl.pages[normalizeID(pageID)]
+}
+
+// URL renders the link to a published page, from the page at fromFile
+func (pl *PageLinks) URL(target *PageLink, blockID string, fromFile string) string {
+	var fragment string
+	if anchor := target.Anchors.Get(blockID); anchor != nil {
+		fragment = "#" + anchor.ID
+	}
+	if pl.style == linkStyleRelative {
+		rel, err := filepath.Rel(pageURLPath(fromFile), pageURLPath(target.FilePath))
+		if err != nil {
+			return pageURLPath(target.FilePath) + fragment
+		}
+		return filepath.ToSlash(rel) + "/" + fragment
+	}
+	return fmt.Sprintf(`{{< relref "%s%s" >}}`, contentPath(target.FilePath), fragment)
+}
+
+// SectionURL renders the link to a section, from the page at fromFile. The section may have no
+// _index.md of its own, it is linked by its url rather than with relref.
+func (pl *PageLinks) SectionURL(section string, fromFile string) string {
+	target := pageURLPath(path.Join(section, sectionMarkdownName))
+	if pl.style == linkStyleRelative {
+		if rel, err := filepath.Rel(pageURLPath(fromFile), target); err == nil {
+			return filepath.ToSlash(rel) + "/"
+		}
+	}
+	return target + "/"
+}
+
+// Unpublished returns the fallback link to a page which is not published, empty means plain text
+func (pl *PageLinks) Unpublished(link string) string {
+	switch pl.unpublishedLink {
+	case unpublishedLinkNotion:
+		return link
+	case unpublishedLinkText:
+		return ""
+	}
+	return pl.unpublishedLink
+}
+
+// contentPath is the path of a file relative to the hugo content folder: content/post/a/index.md -> /post/a/index.md
+func contentPath(filePath string) string {
+	return path.Join("/", strings.TrimPrefix(filePath, contentDir+"/"))
+}
+
+// pageURLPath is the hugo pretty url of a content file: content/post/a/index.md -> /post/a
+func pageURLPath(filePath string) string {
+	p := contentPath(filePath)
+	switch base := path.Base(p); base {
+	case defaultMarkdownName, sectionMarkdownName:
+		p = path.Dir(p)
+	default:
+		p = strings.TrimSuffix(p, path.Ext(base))
+	}
+	return path.Join("/", p)
+}
+
+var (
+	regexGithubIssue = regexp.MustCompile(`^/([\w.-]+)/([\w.-]+)/(issues|pull|discussions)/(\d+)`)
+	regexGithubRepo  = regexp.MustCompile(`^/([\w.-]+)/([\w.-]+)/?$`)
+)
+
+// linkPreviewTitle names what a link preview points to, from its url alone: owner/repo#12 for a github issue
+func linkPreviewTitle(link string) (title string, provider string) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", ""
+	}
+	host := strings.TrimPrefix(u.Host, "www.")
+	switch {
+	case host == "github.com":
+		if m := regexGithubIssue.FindStringSubmatch(u.Path); m != nil {
+			return fmt.Sprintf("%s/%s#%s", m[1], m[2], m[4]), "github"
+		}
+		if m := regexGithubRepo.FindStringSubmatch(u.Path); m != nil {
+			return m[1] + "/" + m[2], "github"
+		}
+		return "", "github"
+	case strings.HasSuffix(host, "slack.com"):
+		return "Slack message in " + strings.TrimSuffix(host, ".slack.com"), "slack"
+	case host == "figma.com":
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(parts) >= 3 {
+			return "Figma: " + strings.ReplaceAll(parts[2], "-", " "), "figma"
+		}
+		return "Figma file", "figma"
+	}
+	return "", ""
+}
+
+// parseNotionLink extracts the page and block ids of a link to notion, both empty for other links
+func parseNotionLink(link string) (pageID string, blockID string) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", ""
+	}
+	if u.Host != "" && u.Host != "notion.so" && !strings.HasSuffix(u.Host, ".notion.so") && !strings.HasSuffix(u.Host, ".notion.site") {
+		return "", ""
+	}
+	if u.Host == "" && !strings.HasPrefix(u.Path, "/") && u.Path != "" {
+		return "", ""
+	}
+	pageID = regexNotionID.FindString(strings.TrimSuffix(u.Path, "/"))
+	// peek links: https://www.notion.so/<database>?p=<page>
+	if p := u.Query().Get("p"); regexNotionID.MatchString(p) {
+		pageID = p
+	}
+	if regexNotionID.MatchString(u.Fragment) {
+		blockID = u.Fragment
+	}
+	return
+}
@@ -0,0 +1,127 @@
+package pkg
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+)
+
+func TestSectionCrumbs(t *testing.T) {
+	for position, want := range map[string][]Crumb{
+		"content/post":       {{Title: "post", Section: "content/post"}},
+		"content/post/tech/": {{Title: "post", Section: "content/post"}, {Title: "tech", Section: "content/post/tech"}},
+		"content":            nil,
+		"data":               nil,
+	} {
+		if got := sectionCrumbs(position); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", position, got, want)
+		}
+	}
+}
+
+// TestBreadcrumb checks the trail links the sections and the pages, the folder pages are plain titles
+func TestBreadcrumb(t *testing.T) {
+	for style, want := range map[string]string{
+		linkStyleRelref:   `[post](/post/) › Guides › [Setup]({{< relref "/post/setup/_index.md" >}}) › Install`,
+		linkStyleRelative: `[post](../../) › Guides › [Setup](../) › Install`,
+	} {
+		tm := New()
+		tm.Report = NewReport()
+		tm.Links = NewPageLinks(Markdown{LinkStyle: style})
+		tm.Links.Add("0123456789abcdef0123456789abcdef", &PageLink{Title: "Setup", FilePath: "content/post/setup/_index.md"})
+		tm.Files = &Files{HomePath: "site", FilePath: "site/content/post/setup/install/index.md"}
+		tm.NotionProps = &NotionProp{Name: "Install"}
+		tm.Trail = append(sectionCrumbs("content/post"), Crumb{Title: "Guides", Folder: true}, Crumb{ID: "0123456789abcdef0123456789abcdef", Title: "setup"})
+
+		mdb := MdBlock{Block: &notion.BreadcrumbBlock{}, Extra: make(map[string]interface{})}
+		if err := tm.injectBreadcrumbInfo(&mdb.Extra); err != nil {
+			t.Fatal(err)
+		}
+		if err := tm.GenBlock("breadcrumb", mdb, true); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSpace(tm.ContentBuffer.String()); got != want {
+			t.Errorf("%s: got %s, want %s", style, got, want)
+		}
+	}
+}
+
+func TestParseNotionLink(t *testing.T) {
+	const page, block = "0123456789abcdef0123456789abcdef", "fedcba9876543210fedcba9876543210"
+	for _, c := range []struct {
+		link          string
+		page, blockID string
+	}{
+		{"https://www.notion.so/My-Page-" + page, page, ""},
+		{"https://www.notion.so/workspace/My-Page-" + page + "/", page, ""},
+		{"https://notion.so/" + page + "#" + block, page, block},
+		{"https://my-site.notion.site/Page-" + page + "?pvs=4", page, ""},
+		{"https://www.notion.so/" + block + "?v=1&p=" + page, page, ""},
+		{"/" + page + "#" + block, page, block},
+		{"/" + page, page, ""},
+		{"#" + block, "", block},
+		{"https://www.notion.so/My-Page-" + page + "#intro", page, ""},
+		{"https://example.com/" + page, "", ""},
+		{"relative/" + page, "", ""},
+		{"https://www.notion.so/about", "", ""},
+	} {
+		if gotPage, gotBlock := parseNotionLink(c.link); gotPage != c.page || gotBlock != c.blockID {
+			t.Errorf("%s: got %q %q, want %q %q", c.link, gotPage, gotBlock, c.page, c.blockID)
+		}
+	}
+}
+
+// TestResolveLink checks the notion links are rewritten to the published pages and their headings,
+// the links to the unpublished pages after unpublishedLink
+func TestResolveLink(t *testing.T) {
+	const (
+		current     = "11111111111111111111111111111111"
+		target      = "22222222222222222222222222222222"
+		unpublished = "33333333333333333333333333333333"
+		heading     = "44444444444444444444444444444444"
+		local       = "55555555555555555555555555555555"
+	)
+	anchors := func(id, text string) *Anchors {
+		var resp notion.BlockChildrenResponse
+		raw := `{"results":[{"object":"block","id":"` + id + `","type":"heading_2","heading_2":{"rich_text":[{"type":"text","text":{"content":"` + text + `"},"plain_text":"` + text + `"}]}}]}`
+		if err := json.Unmarshal([]byte(raw), &resp); err != nil {
+			t.Fatal(err)
+		}
+		a := NewAnchors()
+		a.Collect(resp.Results)
+		return a
+	}
+	for _, c := range []struct {
+		style, unpublishedLink string
+		link, want             string
+	}{
+		{"", "", "https://www.notion.so/Target-" + target, `{{< relref "/post/target/index.md" >}}`},
+		{"", "", "https://www.notion.so/Target-" + target + "#" + heading, `{{< relref "/post/target/index.md#install" >}}`},
+		{"", "", "/" + target + "#" + strings.Repeat("f", 32), `{{< relref "/post/target/index.md" >}}`},
+		{"", "", "https://www.notion.so/Current-" + current + "#" + local, "#setup"},
+		{"", "", "#" + local, "#setup"},
+		{linkStyleRelative, "", "https://www.notion.so/Target-" + target, "../target/"},
+		{linkStyleRelative, "", "/" + target + "#" + heading, "../target/#install"},
+		{"", "", "https://www.notion.so/Draft-" + unpublished, "https://www.notion.so/Draft-" + unpublished},
+		{"", unpublishedLinkText, "https://www.notion.so/Draft-" + unpublished, ""},
+		{"", "/drafts/", "https://www.notion.so/Draft-" + unpublished, "/drafts/"},
+		{"", "", "https://example.com/page", "https://example.com/page"},
+	} {
+		tm := New()
+		tm.Report = NewReport()
+		tm.Links = NewPageLinks(Markdown{LinkStyle: c.style, UnpublishedLink: c.unpublishedLink})
+		tm.Links.Add(current, &PageLink{Title: "Current", FilePath: "content/post/current/index.md"})
+		tm.Links.Add(target, &PageLink{Title: "Target", FilePath: "content/post/target/index.md", Anchors: anchors(heading, "Install")})
+		tm.Files = &Files{HomePath: "site", FilePath: "site/content/post/current/index.md"}
+		tm.Anchors = anchors(local, "Setup")
+		if got := tm.resolveLink(c.link); got != c.want {
+			t.Errorf("%s %s %s: got %q, want %q", c.style, c.unpublishedLink, c.link, got, c.want)
+		}
+		if warned := len(tm.Report.Warnings) > 0; warned != strings.Contains(c.link, unpublished) {
+			t.Errorf("%s: warnings %q", c.link, tm.Report.Warnings)
+		}
+	}
+}
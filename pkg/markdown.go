@@ -11,7 +11,9 @@ import (
 	"gopkg.in/yaml.v3"
 	"io"
 	"log"
+	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
 	"text/template"
 )
@@ -20,16 +22,6 @@ import (
 var mdTemplatesFS embed.FS
 
 var (
-	extendedSyntaxBlocks            = []any{reflect.TypeOf(&notion.CalloutBlock{})}
-	blockTypeInExtendedSyntaxBlocks = func(bType any) bool {
-		for _, blockType := range extendedSyntaxBlocks {
-			if blockType == bType {
-				return true
-			}
-		}
-
-		return false
-	}
 	mediaBlocks          = []any{reflect.TypeOf(&notion.VideoBlock{}), reflect.TypeOf(&notion.ImageBlock{}), reflect.TypeOf(&notion.FileBlock{}), reflect.TypeOf(&notion.PDFBlock{}), reflect.TypeOf(&notion.AudioBlock{})}
 	blockTypeMediaBlocks = func(bType any) bool {
 		for _, blockType := range mediaBlocks {
@@ -46,15 +38,32 @@ type MdBlock struct {
 	notion.Block
 	children []notion.Block
 	Depth    int
-	Extra    map[string]interface{}
+	// Indent is the prefix of the block lines, nested list items are indented under their parent item
+	Indent string
+	// Number of a numbered list item in its list
+	Number int
+	Extra  map[string]interface{}
+	// childrenRendered is set when the block template renders its children itself
+	childrenRendered bool
 }
 
-type MediaBlock struct {
-	notion.ImageBlock
-	notion.VideoBlock
-	notion.PDFBlock
-	notion.AudioBlock
-	notion.FileBlock
+// childIndent is the indent the children of the block are rendered with
+func (mdb *MdBlock) childIndent() string {
+	switch mdb.Block.(type) {
+	case *notion.BulletedListItemBlock, *notion.ToDoBlock:
+		return mdb.Indent + "  "
+	case *notion.NumberedListItemBlock:
+		return mdb.Indent + strings.Repeat(" ", len(strconv.Itoa(mdb.Number))+2)
+	}
+	return mdb.Indent
+}
+
+func isListItem(block notion.Block) bool {
+	switch block.(type) {
+	case *notion.BulletedListItemBlock, *notion.NumberedListItemBlock, *notion.ToDoBlock, *notion.ChildPageBlock:
+		return true
+	}
+	return false
 }
 
 type ToMarkdown struct {
@@ -66,7 +75,16 @@ type ToMarkdown struct {
 	ImgVisitPath      string
 	ArticleFolderPath string
 	ContentTemplate   string
-	extra             map[string]interface{}
+	Anchors           *Anchors
+	Links             *PageLinks
+	Report            *Report
+	Config            Markdown
+	Databases         map[string]*InlineDatabase
+	Embeds            *EmbedProviders
+	OpenGraph         *OpenGraphCache
+	// Trail are the pages above the current one, from the top
+	Trail []Crumb
+	extra map[string]interface{}
 }
 
 type FrontMatter struct {
@@ -81,6 +99,7 @@ type FrontMatter struct {
 	IsTranslated interface{}   `yaml:",flow"`
 	Lastmod      interface{}   `yaml:",flow"`
 	Description  interface{}   `yaml:",flow"`
+	Summary      interface{}   `yaml:",flow"`
 	Draft        interface{}   `yaml:",flow"`
 	ExpiryDate   interface{}   `yaml:",flow"`
 	//PublishDate   interface{}   `yaml:",flow"`
@@ -89,44 +108,41 @@ type FrontMatter struct {
 	//IsCJKLanguage interface{} `yaml:",flow"`
 	Slug   interface{} `yaml:",flow"`
 	Image  interface{} `yaml:",flow"`
+	Icon   interface{} `yaml:",flow"`
 	Weight interface{} `yaml:",flow"`
+	// ImagePlaceholder and ImageColor preview the cover, or the first image of the page
+	ImagePlaceholder interface{} `yaml:",flow"`
+	ImageColor       interface{} `yaml:",flow"`
 }
 
 func New() *ToMarkdown {
 	return &ToMarkdown{
 		FrontMatter:   make(map[string]interface{}),
 		ContentBuffer: new(bytes.Buffer),
+		Anchors:       NewAnchors(),
 		extra:         make(map[string]interface{}),
 	}
 }
 
 func (tm *ToMarkdown) WithFrontMatter(page notion.Page) {
-	tm.injectFrontMatterCover(page.Cover)
-	pageProps := page.Properties.(notion.DatabasePageProperties)
+	tm.FrontMatter = make(map[string]interface{})
+	tm.injectFrontMatterMedia(page.Cover, page.Icon)
+	pageProps, _ := page.Properties.(notion.DatabasePageProperties)
 	for fmKey, property := range pageProps {
 		tm.injectFrontMatter(fmKey, property)
 	}
 	tm.FrontMatter["Title"] = tm.NotionProps.GetTitle()
-}
-
-func (tm *ToMarkdown) EnableExtendedSyntax(target string) {
-	tm.extra["ExtendedSyntaxEnabled"] = true
-	tm.extra["ExtendedSyntaxTarget"] = target
-}
-
-func (tm *ToMarkdown) ExtendedSyntaxEnabled() bool {
-	if v, ok := tm.extra["ExtendedSyntaxEnabled"].(bool); ok {
-		return v
+	if tm.NotionProps.Weight > 0 {
+		tm.FrontMatter["Weight"] = tm.NotionProps.Weight
+	}
+	if tm.Config.Summary.FrontMatter && tm.NotionProps.Description != "" {
+		tm.FrontMatter["Summary"] = tm.NotionProps.Description
 	}
-	return false
-}
-
-func (tm *ToMarkdown) shouldSkipRender(bType any) bool {
-	return !tm.ExtendedSyntaxEnabled() && blockTypeInExtendedSyntaxBlocks(bType)
 }
 
 func (tm *ToMarkdown) GenerateTo(ns *NotionSite) error {
 	if tm.NotionProps.IsSettingFile != true && tm.NotionProps.IsFolder() != true {
+		tm.injectFirstImagePreview(ns.currentBlocks)
 		if err := tm.GenFrontMatter(ns.files.currentWriter); err != nil {
 			return err
 		}
@@ -149,29 +165,25 @@ func (tm *ToMarkdown) GenerateTo(ns *NotionSite) error {
 	return nil
 }
 
+// isFrontMatterField tells whether a front matter key is a field of FrontMatter
+func isFrontMatterField(key string) bool {
+	_, ok := reflect.TypeOf(FrontMatter{}).FieldByNameFunc(func(name string) bool {
+		return strings.EqualFold(name, key)
+	})
+	return ok
+}
+
 func (tm *ToMarkdown) GenFrontMatter(writer io.Writer) error {
 	fm := &FrontMatter{}
 	if len(tm.FrontMatter) == 0 {
 		return nil
 	}
-	var imageKey string
-	var imagePath string
-	nfm := make(map[string]interface{})
+	// the files properties are written as lists under their own key
+	files := make(map[string]mediaLinks)
 	for key, value := range tm.FrontMatter {
-		nfm[strings.ToLower(key)] = value
-		// find image FrontMatter
-		switch v := value.(type) {
-		case string:
-			if strings.HasPrefix(v, "image|") {
-				imageKey = key
-				imageOriginPath := v[len("image|"):]
-				imagePath = tm.downloadFrontMatterImage(imageOriginPath)
-				fmt.Println(imagePath)
-			}
-		default:
-
+		if links, ok := value.(mediaLinks); ok && !isFrontMatterField(key) {
+			files[strings.ToLower(key)] = links
 		}
-
 	}
 	if err := mapstructure.Decode(tm.FrontMatter, &fm); err != nil {
 	}
@@ -188,9 +200,12 @@ func (tm *ToMarkdown) GenFrontMatter(writer io.Writer) error {
 	buffer := new(bytes.Buffer)
 	buffer.WriteString("---\n")
 	buffer.Write(frontMatters)
-	// todo write dynamic key image FrontMatter
-	if len(imagePath) > 0 {
-		buffer.WriteString(fmt.Sprintf("%s: \"%s\"\n", strings.ToLower(imageKey), imagePath))
+	if len(files) > 0 {
+		fileMatters, err := yaml.Marshal(files)
+		if err != nil {
+			return err
+		}
+		buffer.Write(fileMatters)
 	}
 	buffer.WriteString("---\n")
 	_, err = io.Copy(writer, buffer)
@@ -198,43 +213,60 @@ func (tm *ToMarkdown) GenFrontMatter(writer io.Writer) error {
 }
 
 func (tm *ToMarkdown) GenContentBlocks(blocks []notion.Block, depth int) error {
-	var sameBlockIdx int
-	var lastBlockType any
+	return tm.genContentBlocks(blocks, depth, "")
+}
+
+// genContentBlocks renders a list of sibling blocks. Each call numbers its own
+// numbered lists, so nested lists and lists interrupted by another block restart at 1.
+func (tm *ToMarkdown) genContentBlocks(blocks []notion.Block, depth int, indent string) error {
+	var number int
+	var lastBlock notion.Block
 	var currentBlockType string
 
-	hasMoreTag := false
+	// the summary separator goes between top level blocks only
+	var summary *summaryBreak
+	if depth == 0 && !tm.NotionProps.IsSettingFile {
+		summary = newSummaryBreak(tm.Config.Summary)
+	}
 	for index, block := range blocks {
-		var addMoreTag = false
 		currentBlockType = GetBlockType(block)
 
-		if tm.shouldSkipRender(reflect.TypeOf(block)) {
-			continue
-		}
-
 		mdb := MdBlock{
-			Block: block,
-			Depth: depth,
-			Extra: tm.extra,
+			Block:  block,
+			Depth:  depth,
+			Indent: indent,
+			Extra:  make(map[string]interface{}),
 		}
 
-		sameBlockIdx++
-		if reflect.TypeOf(block) != lastBlockType {
-			sameBlockIdx = 0
+		if _, ok := block.(*notion.NumberedListItemBlock); ok {
+			number++
+			if _, ok := lastBlock.(*notion.NumberedListItemBlock); !ok {
+				number = 1
+			}
+			mdb.Number = number
+		}
+		// a list needs a blank line after it, or the next paragraph continues the last item
+		if lastBlock != nil && isListItem(lastBlock) && !isListItem(block) {
+			tm.blankLine()
+		}
+		summary.write(tm.ContentBuffer, lastBlock, block)
+		if summary.replaces(block) {
+			lastBlock = block
+			continue
 		}
-		mdb.Extra["SameBlockIdx"] = sameBlockIdx
 
-		var generate = func(more bool) error {
-			if err := tm.GenBlock(currentBlockType, mdb, addMoreTag, false); err != nil {
+		var generate = func() error {
+			if err := tm.GenBlock(currentBlockType, mdb, false); err != nil {
 				return err
 			}
-			lastBlockType = reflect.TypeOf(block)
+			lastBlock = block
 			fmt.Println(fmt.Sprintf("Processing the %d th %s tpye block  -> %s ", index, reflect.TypeOf(block), block.ID()))
 			return nil
 		}
 
 		if tm.NotionProps.IsSettingFile == true {
 			if reflect.TypeOf(block) == reflect.TypeOf(&notion.CodeBlock{}) {
-				generate(false)
+				generate()
 				continue
 			}
 		}
@@ -245,21 +277,26 @@ func (tm *ToMarkdown) GenContentBlocks(blocks []notion.Block, depth int) error {
 			return err
 		}
 
-		// todo configurable
-		if tm.ContentBuffer.Len() > 60 && !hasMoreTag && !tm.NotionProps.IsSettingFile {
-			addMoreTag = tm.ContentBuffer.Len() > 60
-			hasMoreTag = true
-		}
-
 		if tm.checkMermaid(block) {
 			currentBlockType = "mermaid"
 		}
 
-		generate(addMoreTag)
+		generate()
+		summary.after(block)
+	}
+	if depth == 0 && lastBlock != nil && isListItem(lastBlock) {
+		tm.blankLine()
 	}
 	return nil
 }
 
+// blankLine ends the content with a blank line, unless it ends with one already
+func (tm *ToMarkdown) blankLine() {
+	if !bytes.HasSuffix(tm.ContentBuffer.Bytes(), []byte("\n\n")) {
+		tm.ContentBuffer.WriteString("\n")
+	}
+}
+
 func (tm *ToMarkdown) checkMermaid(block any) bool {
 	if reflect.TypeOf(block) == reflect.TypeOf(&notion.CodeBlock{}) {
 		if block.(*notion.CodeBlock).Language != nil && *block.(*notion.CodeBlock).Language == "mermaid" {
@@ -270,14 +307,15 @@ func (tm *ToMarkdown) checkMermaid(block any) bool {
 }
 
 // GenBlock notion to hugo shortcodes template
-func (tm *ToMarkdown) GenBlock(bType string, block MdBlock, addMoreTag bool, skip bool) error {
+func (tm *ToMarkdown) GenBlock(bType string, block MdBlock, skip bool) error {
 	if tm.NotionProps.IsSettingFile == true {
 		bType = "noop"
 	}
 	funcs := sprig.TxtFuncMap()
 	funcs["deref"] = func(i *bool) bool { return *i }
-	funcs["rich2md"] = ConvertRichText
-	funcs["table2md"] = ConvertTable
+	funcs["rich2md"] = tm.convertRichText
+	funcs["plain"] = plainText
+	funcs["table2md"] = tm.convertTable
 	funcs["log"] = func(p any) string {
 		s, _ := json.Marshal(p)
 		return string(s)
@@ -294,37 +332,75 @@ func (tm *ToMarkdown) GenBlock(bType string, block MdBlock, addMoreTag bool, ski
 	}
 
 	if !skip {
-		if addMoreTag {
-			tm.ContentBuffer.WriteString("<!--more-->")
-		}
-
-		if block.HasChildren() {
+		if block.HasChildren() && !block.childrenRendered {
 			block.Depth++
 			tm.NotionProps.getChildrenBlocks(&block)
-			return tm.GenContentBlocks(block.children, block.Depth)
+			// a paragraph right under a list item would continue the text of the item
+			if isListItem(block.Block) && len(block.children) > 0 && !isListItem(block.children[0]) {
+				tm.blankLine()
+			}
+			return tm.genContentBlocks(block.children, block.Depth, block.childIndent())
 		}
 	}
 
 	return nil
 }
 
-func (tm *ToMarkdown) downloadFrontMatterImage(url string) string {
+// renderChildren renders the children of a block apart, for templates wrapping them
+func (tm *ToMarkdown) renderChildren(mdb *MdBlock) (string, error) {
+	mdb.childrenRendered = true
+	if !mdb.HasChildren() {
+		return "", nil
+	}
+	tm.NotionProps.getChildrenBlocks(mdb)
+	buffer := tm.ContentBuffer
+	tm.ContentBuffer = new(bytes.Buffer)
+	defer func() {
+		tm.ContentBuffer = buffer
+	}()
+	if err := tm.genContentBlocks(mdb.children, mdb.Depth+1, ""); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(tm.ContentBuffer.String(), "\n"), nil
+}
 
-	image := &notion.FileBlock{
-		Type: "external",
-		File: nil,
-		External: &notion.FileExternal{
-			URL: url,
-		},
+// resolveLink rewrites links to notion pages into site links: a heading of the current page
+// becomes its anchor, a published page its site url and other pages the unpublished fallback.
+// An empty result means the text should not be linked.
+func (tm *ToMarkdown) resolveLink(link string) string {
+	pageID, blockID := parseNotionLink(link)
+	if pageID == "" && blockID == "" {
+		return link
 	}
-	if err := tm.Files.DownloadMedia(image); err != nil {
-		return ""
+	if anchor := tm.Anchors.Get(blockID); anchor != nil {
+		return "#" + anchor.ID
 	}
-
-	return image.External.URL
+	if pageID == "" || tm.Links == nil {
+		return link
+	}
+	target := tm.Links.Get(pageID)
+	if target == nil {
+		if tm.Report != nil {
+			tm.Report.Warnf("%s links to the unpublished page %s", tm.Files.FilePath, link)
+		}
+		return tm.Links.Unpublished(link)
+	}
+	from, err := filepath.Rel(tm.Files.HomePath, tm.Files.FilePath)
+	if err != nil {
+		return link
+	}
+	return tm.Links.URL(target, blockID, filepath.ToSlash(from))
 }
 
 func ConvertTable(rows []notion.Block) string {
+	return convertTable(rows, nil)
+}
+
+func (tm *ToMarkdown) convertTable(rows []notion.Block) string {
+	return convertTable(rows, tm.richTextOptions())
+}
+
+func convertTable(rows []notion.Block, opts *richTextOptions) string {
 	buf := &bytes.Buffer{}
 
 	if len(rows) == 0 {
@@ -333,25 +409,26 @@ func ConvertTable(rows []notion.Block) string {
 	for i, row := range rows {
 		rowBlock := row.(*notion.TableRowBlock)
 		if i == 1 {
-			buf.WriteString(ConvertRow(rowBlock, "---"))
+			buf.WriteString(convertRow(rowBlock, "---", opts))
 		}
-		buf.WriteString(ConvertRow(rowBlock, ""))
+		buf.WriteString(convertRow(rowBlock, "", opts))
 	}
 
 	return buf.String()
 }
 
 func ConvertRow(r *notion.TableRowBlock, fmt string) string {
+	return convertRow(r, fmt, nil)
+}
+
+func convertRow(r *notion.TableRowBlock, fmt string, opts *richTextOptions) string {
 	var rowMd = ""
 	for i, cell := range r.Cells {
 		if i == 0 {
 			rowMd += "|"
 		}
-		var a = ""
-		for _, rich := range cell {
-			a += ConvertRich(rich)
-
-		}
+		// a line break would end the table row
+		var a = strings.ReplaceAll(convertRichText(cell, opts), "\n", "<br>")
 		if fmt != "" {
 			a = fmt
 		}
@@ -363,71 +440,3 @@ func ConvertRow(r *notion.TableRowBlock, fmt string) string {
 	}
 	return rowMd
 }
-
-func ConvertRichText(t []notion.RichText) string {
-	buf := &bytes.Buffer{}
-	for _, word := range t {
-		buf.WriteString(ConvertRich(word))
-	}
-
-	return buf.String()
-}
-
-func ConvertRich(t notion.RichText) string {
-	switch t.Type {
-	case notion.RichTextTypeText:
-		if t.Text.Link != nil {
-			return fmt.Sprintf(
-				emphFormat(t.Annotations),
-				fmt.Sprintf("[%s](%s)", t.Text.Content, t.Text.Link.URL),
-			)
-		}
-		if strings.TrimSpace(t.Text.Content) == "" {
-			return ""
-		}
-		return fmt.Sprintf(emphFormat(t.Annotations), strings.TrimSpace(t.Text.Content))
-	case notion.RichTextTypeEquation:
-	case notion.RichTextTypeMention:
-		return fmt.Sprintf("[%s](%s)", t.PlainText, *t.HRef)
-	}
-	return ""
-}
-
-func emphFormat(a *notion.Annotations) (s string) {
-	s = "%s"
-	if a == nil {
-		return
-	}
-	if a.Code {
-		return "`%s`"
-	}
-	switch {
-	case a.Bold && a.Italic:
-		s = " ***%s*** "
-	case a.Bold:
-		s = " **%s** "
-	case a.Italic:
-		s = " *%s* "
-	}
-	if a.Underline {
-		s = " __" + s + "__ "
-	} else if a.Strikethrough {
-		s = " ~~" + s + "~~ "
-	}
-	s = textColor(a, s)
-	return s
-}
-
-func textColor(a *notion.Annotations, text string) (s string) {
-	s = text
-	if a.Color == "default" {
-		return
-	}
-
-	var cssKey = "color"
-	if strings.Contains(string(a.Color), "_background") {
-		cssKey = "background-color"
-	}
-	s = fmt.Sprintf(`<span style="%s: %s;">%s</span>`, cssKey, ColorMap[string(a.Color)], text)
-	return
-}
@@ -0,0 +1,241 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+	"gopkg.in/yaml.v3"
+)
+
+// decodeBlocks decodes blocks with their children, the notion client decodes the blocks without
+func decodeBlocks(t *testing.T, raws []json.RawMessage) []notion.Block {
+	var blocks []notion.Block
+	for _, raw := range raws {
+		var resp notion.BlockChildrenResponse
+		if err := json.Unmarshal([]byte(`{"results":[`+string(raw)+`]}`), &resp); err != nil {
+			t.Fatal(err)
+		}
+		var nested struct {
+			Children []json.RawMessage `json:"children"`
+		}
+		if err := json.Unmarshal(raw, &nested); err != nil {
+			t.Fatal(err)
+		}
+		block := resp.Results[0]
+		if len(nested.Children) > 0 {
+			children := decodeBlocks(t, nested.Children)
+			switch b := block.(type) {
+			case *notion.ParagraphBlock:
+				b.Children = children
+			case *notion.BulletedListItemBlock:
+				b.Children = children
+			case *notion.NumberedListItemBlock:
+				b.Children = children
+			case *notion.ToDoBlock:
+				b.Children = children
+			case *notion.ToggleBlock:
+				b.Children = children
+			case *notion.CalloutBlock:
+				b.Children = children
+			case *notion.QuoteBlock:
+				b.Children = children
+			default:
+				t.Fatalf("block %s has no children", block.ID())
+			}
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// testFileServer serves the start of a file of the extension of the path, a 2x2 png for the others,
+// as binary/octet-stream like notion does
+func testFileServer(t *testing.T) *httptest.Server {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	heads := map[string]string{
+		".mp4": "\x00\x00\x00\x18ftypmp42",
+		".mp3": "ID3\x03\x00\x00\x00",
+		".pdf": "%PDF-1.4\n",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "binary/octet-stream")
+		if head, ok := heads[path.Ext(r.URL.Path)]; ok {
+			w.Write([]byte(head))
+			return
+		}
+		w.Write(buf.Bytes())
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testMarkdown is a converter of the page content/post/test in a temporary home path
+func testMarkdown(t *testing.T, config Markdown) *ToMarkdown {
+	config.HomePath = t.TempDir()
+	files := NewFiles(Config{Markdown: config})
+	files.Media = LoadMediaIndex("")
+	files.Position = "content/post"
+	files.Slug = "test"
+	files.FileFolderPath = filepath.Join(config.HomePath, "content", "post", "test")
+	files.FilePath = filepath.Join(files.FileFolderPath, defaultMarkdownName)
+	files.MediaPath = filepath.Join(files.FileFolderPath, mediaRelativePath)
+	if err := files.SetPublicLink(config.ImagePublicLink); err != nil {
+		t.Fatal(err)
+	}
+	tm := New()
+	tm.Config = config
+	tm.Files = files
+	tm.Report = NewReport()
+	tm.Links = NewPageLinks(config)
+	tm.Databases = make(map[string]*InlineDatabase)
+	tm.NotionProps = &NotionProp{Name: "Test"}
+	return tm
+}
+
+// TestGenContentBlocks renders every testdata/blocks/*.json page and compares it with the
+// .golden file next to it, run with -update to rewrite them. A fixture has the markdown config
+// of the page and its blocks, the children of a block in its children key. $SERVER is the url
+// of a server of test files.
+func TestGenContentBlocks(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "blocks", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := testFileServer(t)
+	for _, input := range inputs {
+		input := input
+		name := strings.TrimSuffix(filepath.Base(input), ".json")
+		t.Run(name, func(t *testing.T) {
+			raw, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			raw = bytes.ReplaceAll(raw, []byte("$SERVER"), []byte(server.URL))
+			var fixture struct {
+				Config map[string]interface{} `json:"config"`
+				Blocks []json.RawMessage       `json:"blocks"`
+			}
+			if err := json.Unmarshal(raw, &fixture); err != nil {
+				t.Fatal(err)
+			}
+			// the config is decoded after its yaml keys, json is yaml
+			var config Markdown
+			configRaw, _ := json.Marshal(fixture.Config)
+			if err := yaml.Unmarshal(configRaw, &config); err != nil {
+				t.Fatal(err)
+			}
+			blocks := decodeBlocks(t, fixture.Blocks)
+			tm := testMarkdown(t, config)
+			tm.Anchors.Collect(blocks)
+			if err := tm.GenContentBlocks(blocks, 0); err != nil {
+				t.Fatal(err)
+			}
+			got := tm.ContentBuffer.String()
+
+			golden := strings.TrimSuffix(input, ".json") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+// TestGenFrontMatterMedia checks the cover, the icon and the files properties are downloaded and
+// linked from the front matter, the emoji icons kept as they are. The front matters are compared
+// with testdata/pages/front_matter_media.golden, run with -update to rewrite it.
+func TestGenFrontMatterMedia(t *testing.T) {
+	server := testFileServer(t)
+	var got bytes.Buffer
+	for _, c := range []struct {
+		name, icon string
+	}{
+		{"file icon", `{"type":"file","file":{"url":"$SERVER/icon.png?X-Amz-Signature=x","expiry_time":"2022-06-05T11:00:00.000Z"}}`},
+		{"external icon", `{"type":"external","external":{"url":"$SERVER/icons/external.png"}}`},
+		{"emoji icon", `{"type":"emoji","emoji":"📚"}`},
+	} {
+		raw := strings.ReplaceAll(`{"object":"page","id":"0123456789abcdef0123456789abcdef","created_time":"2022-06-05T10:00:00Z",
+			"parent":{"type":"database_id","database_id":"d"},
+			"icon":`+c.icon+`,
+			"cover":{"type":"external","external":{"url":"$SERVER/cover.png"}},
+			"properties":{
+				"Name":{"id":"title","type":"title","title":[{"type":"text","text":{"content":"Media"},"plain_text":"Media"}]},
+				"Attachments":{"id":"a","type":"files","files":[
+					{"name":"paper.pdf","type":"file","file":{"url":"$SERVER/paper.pdf?X-Amz-Signature=x","expiry_time":"2022-06-05T11:00:00.000Z"}},
+					{"name":"song.mp3","type":"external","external":{"url":"$SERVER/song.mp3"}}]}}}`, "$SERVER", server.URL)
+		var page notion.Page
+		if err := json.Unmarshal([]byte(raw), &page); err != nil {
+			t.Fatal(err)
+		}
+		tm := testMarkdown(t, Markdown{})
+		tm.NotionProps = NewNotionProp(page)
+		tm.WithFrontMatter(page)
+		fmt.Fprintf(&got, "-- %s --\n", c.name)
+		if err := tm.GenFrontMatter(&got); err != nil {
+			t.Fatal(err)
+		}
+		if len(tm.Report.Warnings) > 0 {
+			t.Errorf("%s: %q", c.name, tm.Report.Warnings)
+		}
+	}
+
+	golden := filepath.Join("testdata", "pages", "front_matter_media.golden")
+	if *update {
+		if err := os.WriteFile(golden, got.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != string(want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got.String(), want)
+	}
+}
+
+// TestGenFrontMatterSummary checks the summary of the page is written to the front matter
+func TestGenFrontMatterSummary(t *testing.T) {
+	tm := New()
+	tm.FrontMatter = map[string]interface{}{"Title": "x", "Summary": "my summary"}
+	var buf bytes.Buffer
+	if err := tm.GenFrontMatter(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "\nsummary: my summary\n") {
+		t.Errorf("no summary in the front matter:\n%s", buf.String())
+	}
+}
+
+func TestCheckSummaryBreak(t *testing.T) {
+	for _, value := range []string{"", "paragraph", "blocks", "divider", "marker", "none"} {
+		if err := checkSummaryBreak(Summaries{Break: value}); err != nil {
+			t.Errorf("break %q: %s", value, err)
+		}
+	}
+	if err := checkSummaryBreak(Summaries{Break: "divder"}); err == nil {
+		t.Error("break divder: no error")
+	}
+}
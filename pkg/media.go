@@ -0,0 +1,306 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/dstotijn/go-notion"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const defaultMediaIndexPath = ".notion-site/media.json"
+
+// mediaExtensions are the file extensions by content type, before the mime package is asked
+var mediaExtensions = map[string]string{
+	"image/jpeg":       ".jpg",
+	"image/png":        ".png",
+	"image/gif":        ".gif",
+	"image/webp":       ".webp",
+	"image/avif":       ".avif",
+	"image/svg+xml":    ".svg",
+	"image/x-icon":     ".ico",
+	"image/bmp":        ".bmp",
+	"video/mp4":        ".mp4",
+	"video/webm":       ".webm",
+	"video/quicktime":  ".mov",
+	"audio/mpeg":       ".mp3",
+	"audio/mp4":        ".m4a",
+	"audio/ogg":        ".ogg",
+	"audio/wav":        ".wav",
+	"application/pdf":  ".pdf",
+	"application/zip":  ".zip",
+	"application/json": ".json",
+	"text/plain":       ".txt",
+}
+
+// MediaEntry is a stored media file, named after the hash of its content
+type MediaEntry struct {
+	File        string `json:"file"`
+	ContentType string `json:"contentType,omitempty"`
+	Size        int64  `json:"size"`
+	// Path is where a copy was last written, to copy it from instead of fetching it again
+	Path string `json:"path,omitempty"`
+}
+
+// mediaLinkData is what the template of the public media links is given
+type mediaLinkData struct {
+	// Position is the content folder of the page, e.g. posts
+	Position string
+	// Slug is the folder of the page, or its file name without extension
+	Slug string
+	// Folder is the media folder of the page in the home path, e.g. posts/my-page/media
+	Folder string
+	// File is the name of the stored file
+	File string
+}
+
+// mediaFile is a file to download, its url is replaced by the link to the stored file
+type mediaFile struct {
+	url *string
+	// expect is the type the file must be of, e.g. image/
+	expect string
+}
+
+// mediaFiles are the files of a media block, a page cover or icon or a files property.
+// Videos linked from elsewhere are embeds and emoji icons are no files, they have none.
+func mediaFiles(media any) []mediaFile {
+	switch m := media.(type) {
+	case *notion.ImageBlock:
+		return mediaFileOf(m.Type, m.File, m.External, "image/")
+	case *notion.VideoBlock:
+		if m.Type != notion.FileTypeFile {
+			return nil
+		}
+		return mediaFileOf(m.Type, m.File, m.External, "video/")
+	case *notion.AudioBlock:
+		return mediaFileOf(m.Type, m.File, m.External, "audio/")
+	case *notion.PDFBlock:
+		return mediaFileOf(m.Type, m.File, m.External, "application/pdf")
+	case *notion.FileBlock:
+		return mediaFileOf(m.Type, m.File, m.External, "")
+	case *notion.Cover:
+		if m == nil {
+			return nil
+		}
+		return mediaFileOf(m.Type, m.File, m.External, "image/")
+	case *notion.Icon:
+		if m == nil {
+			return nil
+		}
+		return mediaFileOf(notion.FileType(m.Type), m.File, m.External, "image/")
+	case []notion.File:
+		var files []mediaFile
+		for i := range m {
+			files = append(files, mediaFileOf(m[i].Type, m[i].File, m[i].External, "")...)
+		}
+		return files
+	}
+	return nil
+}
+
+func mediaFileOf(fileType notion.FileType, file *notion.FileFile, external *notion.FileExternal, expect string) []mediaFile {
+	if fileType == notion.FileTypeExternal && external != nil {
+		return []mediaFile{{url: &external.URL, expect: expect}}
+	}
+	if fileType == notion.FileTypeFile && file != nil {
+		return []mediaFile{{url: &file.URL, expect: expect}}
+	}
+	return nil
+}
+
+// MediaIndex maps the source of every media file to the stored file, across runs
+type MediaIndex struct {
+	path string
+	// Sources are the stored files by source: the url without the signature for notion files
+	Sources map[string]*MediaEntry `json:"sources"`
+	// Blocks are the stored files by id of the block they are used in
+	Blocks map[string]string `json:"blocks"`
+	// Images are the processed images by stored file
+	Images map[string]*ImageInfo `json:"images,omitempty"`
+	// Previews are the placeholders of the stored images by file
+	Previews map[string]*ImagePreview `json:"previews,omitempty"`
+}
+
+// LoadMediaIndex reads the media index, a missing or broken index is an empty one
+func LoadMediaIndex(indexPath string) *MediaIndex {
+	index := &MediaIndex{path: indexPath}
+	if raw, err := os.ReadFile(indexPath); err == nil {
+		_ = json.Unmarshal(raw, index)
+	}
+	if index.Sources == nil {
+		index.Sources = make(map[string]*MediaEntry)
+	}
+	if index.Blocks == nil {
+		index.Blocks = make(map[string]string)
+	}
+	if index.Images == nil {
+		index.Images = make(map[string]*ImageInfo)
+	}
+	if index.Previews == nil {
+		index.Previews = make(map[string]*ImagePreview)
+	}
+	return index
+}
+
+func (mi *MediaIndex) Save() error {
+	if mi == nil || mi.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(mi.path), defaultPermission); err != nil {
+		return err
+	}
+	raw, err := json.MarshalIndent(mi, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(mi.path, raw, 0644)
+}
+
+// mediaSourceKey identifies a media file across runs: notion signs its file urls
+// with a query which changes every hour, the path stays the same
+func mediaSourceKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	if isNotionHosted(u) {
+		u.RawQuery = ""
+	}
+	u.Fragment = ""
+	return u.String()
+}
+
+// notionBuckets are the s3 buckets notion keeps the uploaded files in
+var notionBuckets = map[string]bool{
+	"prod-files-secure":        true,
+	"secure.notion-static.com": true,
+	"public.notion-static.com": true,
+}
+
+// isNotionHosted tells whether the url is a file uploaded to notion: on its own hosts or in its
+// buckets, the other s3 files are external ones with a query of their own
+func isNotionHosted(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	for _, domain := range []string{"notion.so", "notion.site", "notion-static.com"} {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	if !strings.HasSuffix(host, ".amazonaws.com") {
+		return false
+	}
+	// the bucket is the first folder of a path style url, e.g. s3.us-west-2.amazonaws.com/secure.notion-static.com,
+	// or the host before s3 of a virtual hosted one, e.g. prod-files-secure.s3.us-west-2.amazonaws.com
+	if strings.HasPrefix(host, "s3.") || strings.HasPrefix(host, "s3-") {
+		bucket, _, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+		return notionBuckets[bucket]
+	}
+	for _, sep := range []string{".s3.", ".s3-"} {
+		if i := strings.Index(host, sep); i > 0 {
+			return notionBuckets[host[:i]]
+		}
+	}
+	return false
+}
+
+// mediaExtension derives the extension of a file from its content type, its first bytes then its url.
+// Sniffed text types come last, svg files sniff as xml.
+func mediaExtension(contentType string, head []byte, rawURL string) string {
+	sniffed := http.DetectContentType(head)
+	if ext := extensionByType(contentType); ext != "" {
+		return ext
+	}
+	if !strings.HasPrefix(sniffed, "text/") {
+		if ext := extensionByType(sniffed); ext != "" {
+			return ext
+		}
+	}
+	if u, err := url.Parse(rawURL); err == nil && path.Ext(u.Path) != "" {
+		return strings.ToLower(path.Ext(u.Path))
+	}
+	if ext := extensionByType(sniffed); ext != "" {
+		return ext
+	}
+	return ".bin"
+}
+
+func extensionByType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || strings.HasSuffix(mediaType, "/octet-stream") {
+		return ""
+	}
+	if ext, ok := mediaExtensions[mediaType]; ok {
+		return ext
+	}
+	if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// typeByExtension is the content type of a file extension, the media types known here first:
+// the mime package knows the video and audio types only from the mime.types file of the system
+func typeByExtension(ext string) string {
+	ext = strings.ToLower(ext)
+	for contentType, known := range mediaExtensions {
+		if known == ext {
+			return contentType
+		}
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// storeMedia writes the content to dir under the hash of its content and returns the entry.
+// A file with the same content already there is kept as is. A file check refuses is not stored.
+func storeMedia(reader io.Reader, contentType string, rawURL string, dir string, check func(*MediaEntry) error) (*MediaEntry, error) {
+	if err := os.MkdirAll(dir, defaultPermission); err != nil {
+		return nil, fmt.Errorf("%s: %s", dir, err)
+	}
+	tmp, err := os.CreateTemp(dir, ".download-*")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create media file: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// the first bytes tell the type when the server doesn't
+	head := make([]byte, 512)
+	n, err := io.ReadFull(reader, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		tmp.Close()
+		return nil, err
+	}
+	head = head[:n]
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.MultiReader(bytes.NewReader(head), reader))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry := &MediaEntry{
+		File:        hex.EncodeToString(hash.Sum(nil))[:32] + mediaExtension(contentType, head, rawURL),
+		ContentType: contentType,
+		Size:        size,
+	}
+	if check != nil {
+		if err := check(entry); err != nil {
+			return nil, err
+		}
+	}
+	target := filepath.Join(dir, entry.File)
+	entry.Path = target
+	if _, err := os.Stat(target); err == nil {
+		return entry, nil
+	}
+	return entry, os.Rename(tmp.Name(), target)
+}
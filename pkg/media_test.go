@@ -0,0 +1,48 @@
+package pkg
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsNotionHosted(t *testing.T) {
+	for _, c := range []struct {
+		url  string
+		want bool
+	}{
+		{"https://prod-files-secure.s3.us-west-2.amazonaws.com/a/b/image.png?X-Amz-Signature=x", true},
+		{"https://s3.us-west-2.amazonaws.com/secure.notion-static.com/a/image.png?X-Amz-Signature=x", true},
+		{"https://s3-us-west-2.amazonaws.com/public.notion-static.com/a/image.png", true},
+		{"https://secure.notion-static.com.s3.amazonaws.com/a/image.png", true},
+		{"https://file.notion.so/f/s/a/image.png?expirationTimestamp=1", true},
+		{"https://www.notion.so/image/https%3A%2F%2Fexample.com%2Fa.png", true},
+		{"https://my-site.notion.site/image.png", true},
+		{"https://my-bucket.s3.amazonaws.com/image.png?versionId=2", false},
+		{"https://s3.us-west-2.amazonaws.com/my-bucket/image.png?versionId=2", false},
+		{"https://d1.cloudfront.net.amazonaws.com/image.png", false},
+		{"https://notnotion.so/image.png", false},
+		{"https://example.com/image.png", false},
+	} {
+		u, err := url.Parse(c.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := isNotionHosted(u); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.url, got, c.want)
+		}
+	}
+}
+
+// TestMediaIndexInHome checks the media index is kept in the home path, not in the working directory
+func TestMediaIndexInHome(t *testing.T) {
+	home := t.TempDir()
+	files := NewFiles(Config{Markdown: Markdown{HomePath: home}})
+	if err := files.Media.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(home, defaultMediaIndexPath)); err != nil {
+		t.Error(err)
+	}
+}
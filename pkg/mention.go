@@ -0,0 +1,105 @@
+package pkg
+
+import (
+	"github.com/dstotijn/go-notion"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDateLayout     = "2006-01-02"
+	defaultDateTimeLayout = "2006-01-02 15:04"
+)
+
+// mentionText returns the text of a mention and where it links to, according to what it points to
+func mentionText(t notion.RichText, opts *richTextOptions) (text string, link string) {
+	m := t.Mention
+	if m == nil {
+		return t.PlainText, ""
+	}
+	var config Mention
+	if opts != nil {
+		config = opts.mention
+	}
+	switch m.Type {
+	case notion.MentionTypeUser:
+		if m.User != nil {
+			return userMention(m.User, t.PlainText, config)
+		}
+	case notion.MentionTypeDate:
+		if m.Date != nil {
+			return formatMentionDate(m.Date, config), ""
+		}
+	case notion.MentionTypePage:
+		if m.Page != nil {
+			return t.PlainText, opts.link("https://www.notion.so/" + normalizeID(m.Page.ID))
+		}
+	case notion.MentionTypeDatabase:
+		if m.Database != nil {
+			return t.PlainText, opts.link("https://www.notion.so/" + normalizeID(m.Database.ID))
+		}
+	case notion.MentionTypeLinkPreview:
+		if m.LinkPreview != nil {
+			return t.PlainText, m.LinkPreview.URL
+		}
+	}
+	if t.HRef != nil {
+		return t.PlainText, opts.link(*t.HRef)
+	}
+	return t.PlainText, ""
+}
+
+func userMention(user *notion.User, plainText string, config Mention) (string, string) {
+	name := user.Name
+	if name == "" {
+		name = strings.TrimPrefix(plainText, "@")
+	}
+	// viper lower cases the map keys, so match the names case insensitively
+	for _, key := range []string{user.ID, strings.ToLower(name), name} {
+		if link, ok := config.Users[key]; ok && link != "" {
+			return name, link
+		}
+	}
+	return name, ""
+}
+
+func formatMentionDate(date *notion.Date, config Mention) string {
+	loc := mentionLocation(date, config)
+	s := formatDateTime(date.Start, loc, config)
+	if date.End != nil {
+		s += " → " + formatDateTime(*date.End, loc, config)
+	}
+	return s
+}
+
+func formatDateTime(dt notion.DateTime, loc *time.Location, config Mention) string {
+	if !dt.HasTime() {
+		layout := config.DateLayout
+		if layout == "" {
+			layout = defaultDateLayout
+		}
+		return dt.Format(layout)
+	}
+	layout := config.DateTimeLayout
+	if layout == "" {
+		layout = defaultDateTimeLayout
+	}
+	t := dt.Time
+	if loc != nil {
+		t = t.In(loc)
+	}
+	return t.Format(layout)
+}
+
+// mentionLocation prefers the configured time zone, then the one set on the date in notion
+func mentionLocation(date *notion.Date, config Mention) *time.Location {
+	for _, name := range []*string{&config.TimeZone, date.TimeZone} {
+		if name == nil || *name == "" {
+			continue
+		}
+		if loc, err := time.LoadLocation(*name); err == nil {
+			return loc
+		}
+	}
+	return nil
+}
@@ -76,6 +76,50 @@ func (api *NotionAPI) queryDatabase(client *notion.Client, config Notion, id str
 	return client.QueryDatabase(context.Background(), id, query)
 }
 
+// queryChildDatabase fetches an inline database with all its rows
+func (api *NotionAPI) queryChildDatabase(client *notion.Client, id string, config ChildDatabases) (*InlineDatabase, error) {
+	spin.Suffix = " Querying child database..."
+	spin.Start()
+	defer spin.Stop()
+	db, err := client.FindDatabaseByID(context.Background(), id)
+	if err != nil {
+		return nil, err
+	}
+	view := config.forDatabase(plainText(db.Title))
+	inline := &InlineDatabase{
+		ID:      id,
+		Title:   plainText(db.Title),
+		Columns: databaseColumns(db.Properties, view.Columns),
+		View:    view,
+	}
+	query := &notion.DatabaseQuery{PageSize: 100}
+	if view.SortBy != "" {
+		direction := notion.SortDirAsc
+		if view.SortDirection == string(notion.SortDirDesc) {
+			direction = notion.SortDirDesc
+		}
+		query.Sorts = []notion.DatabaseQuerySort{{Property: view.SortBy, Direction: direction}}
+	}
+	for {
+		res, err := client.QueryDatabase(context.Background(), id, query)
+		if err != nil {
+			return nil, err
+		}
+		inline.Rows = append(inline.Rows, res.Results...)
+		if !res.HasMore || res.NextCursor == nil {
+			return inline, nil
+		}
+		query.StartCursor = *res.NextCursor
+	}
+}
+
+func (api *NotionAPI) queryPage(client *notion.Client, pageID string) (notion.Page, error) {
+	spin.Suffix = " Fetching child page..."
+	spin.Start()
+	defer spin.Stop()
+	return client.FindPageByID(context.Background(), pageID)
+}
+
 func (api *NotionAPI) queryBlockChildren(client *notion.Client, blockID string) (blocks []notion.Block, err error) {
 	spin.Suffix = " Fetching blocks tree..."
 	spin.Start()
@@ -133,6 +177,12 @@ func (api *NotionAPI) retrieveBlockChildren(client *notion.Client, blockID strin
 			block.(*notion.ToDoBlock).Children, err = api.retrieveBlockChildren(client, block.ID())
 		case reflect.TypeOf(&notion.TableBlock{}):
 			block.(*notion.TableBlock).Children, err = api.retrieveBlockChildren(client, block.ID())
+		case reflect.TypeOf(&notion.Heading1Block{}):
+			block.(*notion.Heading1Block).Children, err = api.retrieveBlockChildren(client, block.ID())
+		case reflect.TypeOf(&notion.Heading2Block{}):
+			block.(*notion.Heading2Block).Children, err = api.retrieveBlockChildren(client, block.ID())
+		case reflect.TypeOf(&notion.Heading3Block{}):
+			block.(*notion.Heading3Block).Children, err = api.retrieveBlockChildren(client, block.ID())
 		case reflect.TypeOf(&notion.ColumnListBlock{}):
 			// todo should support column list block？
 		}
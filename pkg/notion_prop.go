@@ -2,7 +2,6 @@ package pkg
 
 import (
 	"github.com/dstotijn/go-notion"
-	"reflect"
 	"time"
 )
 
@@ -83,6 +82,12 @@ type NotionProp struct {
 	Types            string
 	IsSettingFile    bool
 	IsCustomNameFile bool
+	// ParentFolder is the folder of the page a child page is nested in, empty for database pages
+	ParentFolder string
+	// IsSection is set for pages with child pages, they are written as a hugo section _index.md
+	IsSection bool
+	// Weight orders the child pages of a page
+	Weight int
 }
 
 func NewNotionProp(page notion.Page) (np *NotionProp) {
@@ -114,16 +119,29 @@ func NewNotionProp(page notion.Page) (np *NotionProp) {
 	return
 }
 
+// NewChildNotionProp returns the props of a page nested in another page, the
+// title is all it has so the position is inherited from the parent page
+func NewChildNotionProp(page notion.Page, parent *NotionProp, weight int) (np *NotionProp) {
+	np = NewNotionProp(page)
+	np.Position = parent.Position
+	np.Weight = weight
+	return
+}
+
 func getPropValue(page notion.Page, key string) notion.DatabasePageProperty {
-	properties := page.Properties.(notion.DatabasePageProperties)
+	properties, _ := page.Properties.(notion.DatabasePageProperties)
 	property := properties[key]
 	return property
 }
 
 func getTitle(page notion.Page, key string) (rst string) {
+	// pages which are not in a database only have a title
+	if props, ok := page.Properties.(notion.PageProperties); ok {
+		return plainText(props.Title.Title)
+	}
 	prop := getPropValue(page, key).Title
 	if prop != nil {
-		rst = ConvertRichText(prop)
+		rst = plainText(prop)
 	}
 	return
 }
@@ -131,7 +149,7 @@ func getTitle(page notion.Page, key string) (rst string) {
 func getRichText(page notion.Page, key string) (rst string) {
 	prop := getPropValue(page, key).RichText
 	if prop != nil {
-		rst = ConvertRichText(prop)
+		rst = plainText(prop)
 	}
 	return
 }
@@ -215,33 +233,5 @@ func (np *NotionProp) IsFolder() bool {
 }
 
 func (np *NotionProp) getChildrenBlocks(block *MdBlock) {
-	switch reflect.TypeOf(block.Block) {
-	case reflect.TypeOf(&notion.QuoteBlock{}):
-		block.children = block.Block.(*notion.QuoteBlock).Children
-	case reflect.TypeOf(&notion.ToggleBlock{}):
-		block.children = block.Block.(*notion.ParagraphBlock).Children
-	case reflect.TypeOf(&notion.ParagraphBlock{}):
-		block.children = block.Block.(*notion.CalloutBlock).Children
-	case reflect.TypeOf(&notion.CalloutBlock{}):
-		block.children = block.Block.(*notion.BulletedListItemBlock).Children
-	case reflect.TypeOf(&notion.BulletedListItemBlock{}):
-		block.children = block.Block.(*notion.QuoteBlock).Children
-	case reflect.TypeOf(&notion.NumberedListItemBlock{}):
-		block.children = block.Block.(*notion.NumberedListItemBlock).Children
-	case reflect.TypeOf(&notion.ToDoBlock{}):
-		block.children = block.Block.(*notion.ToDoBlock).Children
-	case reflect.TypeOf(&notion.CodeBlock{}):
-		block.children = block.Block.(*notion.CodeBlock).Children
-	case reflect.TypeOf(&notion.CodeBlock{}):
-		block.children = block.Block.(*notion.ColumnBlock).Children
-	//case reflect.TypeOf(&notion.ColumnListBlock{}):
-	//	return block.Block.(*notion.ColumnListBlock).Children
-	case reflect.TypeOf(&notion.TableBlock{}):
-		block.children = block.Block.(*notion.TableBlock).Children
-	case reflect.TypeOf(&notion.SyncedBlock{}):
-		block.children = block.Block.(*notion.SyncedBlock).Children
-	case reflect.TypeOf(&notion.TemplateBlock{}):
-		block.children = block.Block.(*notion.TemplateBlock).Children
-	}
-
+	block.children = blockChildren(block.Block)
 }
@@ -0,0 +1,146 @@
+package pkg
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/otiai10/opengraph"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	defaultOpenGraphCacheDir = ".notion-site/opengraph"
+	defaultOpenGraphTTL      = 7 * 24 * time.Hour
+	defaultOpenGraphTimeout  = 10 * time.Second
+)
+
+// LinkCard is the preview of a link, from the opengraph metadata of the page
+type LinkCard struct {
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	Description string    `json:"description,omitempty"`
+	Image       string    `json:"image,omitempty"`
+	Icon        string    `json:"icon,omitempty"`
+	FetchedAt   time.Time `json:"fetchedAt"`
+}
+
+// OpenGraphCache fetches link cards, keeping them on disk so the pages linked to
+// are fetched once per ttl and a dead site still renders from the last fetch
+type OpenGraphCache struct {
+	dir     string
+	ttl     time.Duration
+	offline bool
+	client  *http.Client
+}
+
+func NewOpenGraphCache(config Bookmarks) *OpenGraphCache {
+	c := &OpenGraphCache{
+		dir:     config.CacheDir,
+		ttl:     config.TTL,
+		offline: config.Offline,
+		client:  &http.Client{Timeout: config.Timeout},
+	}
+	if c.dir == "" {
+		c.dir = defaultOpenGraphCacheDir
+	}
+	if c.ttl == 0 {
+		c.ttl = defaultOpenGraphTTL
+	}
+	if c.client.Timeout == 0 {
+		c.client.Timeout = defaultOpenGraphTimeout
+	}
+	return c
+}
+
+// Card returns the card of a link: fresh from the cache, fetched, stale from the cache or
+// a plain card with the link as title, in that order. The error tells why it isn't fetched.
+func (c *OpenGraphCache) Card(link string) (*LinkCard, error) {
+	cached := c.load(link)
+	if cached != nil && (c.offline || time.Since(cached.FetchedAt) < c.ttl) {
+		return cached, nil
+	}
+	if c.offline {
+		return plainLinkCard(link), fmt.Errorf("%s is not cached", link)
+	}
+	card, err := c.fetch(link)
+	if err != nil {
+		if cached != nil {
+			return cached, err
+		}
+		return plainLinkCard(link), err
+	}
+	if err := c.save(card); err != nil {
+		return card, err
+	}
+	return card, nil
+}
+
+func (c *OpenGraphCache) fetch(link string) (*LinkCard, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.client.Timeout)
+	defer cancel()
+	og, err := opengraph.FetchWithContext(ctx, link, c.client)
+	if err != nil {
+		return nil, err
+	}
+	og.ToAbsURL()
+	card := &LinkCard{
+		URL:         link,
+		Title:       og.Title,
+		Description: og.Description,
+		Icon:        og.Favicon,
+		FetchedAt:   time.Now(),
+	}
+	for _, img := range og.Image {
+		if img != nil && img.URL != "" {
+			card.Image = img.URL
+			break
+		}
+	}
+	if card.Title == "" {
+		card.Title = plainLinkCard(link).Title
+	}
+	return card, nil
+}
+
+func (c *OpenGraphCache) path(link string) string {
+	sum := sha1.Sum([]byte(link))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *OpenGraphCache) load(link string) *LinkCard {
+	raw, err := os.ReadFile(c.path(link))
+	if err != nil {
+		return nil
+	}
+	var card LinkCard
+	if err := json.Unmarshal(raw, &card); err != nil {
+		return nil
+	}
+	return &card
+}
+
+func (c *OpenGraphCache) save(card *LinkCard) error {
+	if err := os.MkdirAll(c.dir, defaultPermission); err != nil {
+		return err
+	}
+	raw, err := json.MarshalIndent(card, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path(card.URL), raw, 0644)
+}
+
+// plainLinkCard is the card of a link without metadata, titled with its host and path
+func plainLinkCard(link string) *LinkCard {
+	title := link
+	if u, err := url.Parse(link); err == nil && u.Host != "" {
+		title = u.Host + u.Path
+	}
+	return &LinkCard{URL: link, Title: title}
+}
@@ -0,0 +1,108 @@
+package pkg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testOpenGraphServer serves a page with opengraph metadata and its image, it counts the fetches of the page
+func testOpenGraphServer(t *testing.T, fetches *int) *httptest.Server {
+	files := testFileServer(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".png") {
+			files.Config.Handler.ServeHTTP(w, r)
+			return
+		}
+		*fetches++
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head><title>Page</title>
+<meta property="og:title" content="Hello">
+<meta property="og:description" content="A page">
+<meta property="og:image" content="/card.png">
+</head><body></body></html>`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestOpenGraphCard checks the order of the cards: fresh from the cache, fetched, stale from the cache, plain
+func TestOpenGraphCard(t *testing.T) {
+	fetches := 0
+	server := testOpenGraphServer(t, &fetches)
+	dir := t.TempDir()
+	link := server.URL + "/page"
+	cache := NewOpenGraphCache(Bookmarks{CacheDir: dir})
+
+	card, err := cache.Card(link)
+	if err != nil || card.Title != "Hello" || card.Description != "A page" || card.Image != server.URL+"/card.png" || fetches != 1 {
+		t.Fatalf("fetched %+v %v after %d fetches", card, err, fetches)
+	}
+	if card, err := cache.Card(link); err != nil || card.Title != "Hello" || fetches != 1 {
+		t.Errorf("fresh: got %+v %v after %d fetches, want the cached card", card, err, fetches)
+	}
+
+	// a stale card is fetched again
+	card.FetchedAt = time.Now().Add(-2 * defaultOpenGraphTTL)
+	if err := cache.save(card); err != nil {
+		t.Fatal(err)
+	}
+	if card, err := cache.Card(link); err != nil || time.Since(card.FetchedAt) > time.Minute || fetches != 2 {
+		t.Errorf("stale: got %+v %v after %d fetches, want a fetched card", card, err, fetches)
+	}
+
+	// offline a stale card is used as it is
+	card.FetchedAt = time.Now().Add(-2 * defaultOpenGraphTTL)
+	if err := cache.save(card); err != nil {
+		t.Fatal(err)
+	}
+	offline := NewOpenGraphCache(Bookmarks{CacheDir: dir, Offline: true})
+	if got, err := offline.Card(link); err != nil || got.Title != "Hello" || !got.FetchedAt.Equal(card.FetchedAt) || fetches != 2 {
+		t.Errorf("offline: got %+v %v after %d fetches, want the stale card", got, err, fetches)
+	}
+	if got, err := offline.Card(server.URL + "/other"); err == nil || got.Title != strings.TrimPrefix(server.URL, "http://")+"/other" || fetches != 2 {
+		t.Errorf("offline, not cached: got %+v %v after %d fetches, want a plain card", got, err, fetches)
+	}
+
+	// a stale card is used when the site is down, a plain card when it isn't cached either
+	server.Close()
+	if got, err := cache.Card(link); err == nil || got.Title != "Hello" {
+		t.Errorf("down: got %+v %v, want the stale card and an error", got, err)
+	}
+	if got, err := cache.Card(server.URL + "/other"); err == nil || !got.FetchedAt.IsZero() {
+		t.Errorf("down, not cached: got %+v %v, want a plain card and an error", got, err)
+	}
+}
+
+// TestLinkCardOfflineImage checks the image of a card downloaded before is linked from the media folder offline
+func TestLinkCardOfflineImage(t *testing.T) {
+	fetches := 0
+	server := testOpenGraphServer(t, &fetches)
+	home := t.TempDir()
+	link := server.URL + "/page"
+	render := func(config Bookmarks) map[string]interface{} {
+		config.CacheDir = filepath.Join(home, "opengraph")
+		config.DownloadImages = true
+		tm := New()
+		tm.Config = Markdown{HomePath: home, Bookmark: config}
+		tm.Report = NewReport()
+		tm.Files = NewFiles(Config{Markdown: tm.Config})
+		tm.Files.MediaPath = filepath.Join(home, "content", "post", "test", mediaRelativePath)
+		extra := map[string]interface{}{}
+		tm.injectLinkCard(link, &extra)
+		if err := tm.Files.Media.Save(); err != nil {
+			t.Fatal(err)
+		}
+		return extra
+	}
+	if extra := render(Bookmarks{}); !strings.HasPrefix(extra["Image"].(string), mediaRelativePath+"/") {
+		t.Fatalf("online: image %s, want a downloaded one", extra["Image"])
+	}
+	server.Close()
+	if extra := render(Bookmarks{Offline: true}); !strings.HasPrefix(extra["Image"].(string), mediaRelativePath+"/") {
+		t.Errorf("offline: image %s, want the downloaded one", extra["Image"])
+	}
+}
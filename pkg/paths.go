@@ -0,0 +1,249 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/dstotijn/go-notion"
+)
+
+const (
+	defaultMediaPattern = "{{.Dir}}/media"
+
+	// staticDir is served at the root of the site, the media files in it are linked from the root
+	staticDir = "static"
+)
+
+// defaultSettingDirs are the folders setting pages can write to: the root of the home path,
+// the hugo config folders, data, i18n and static
+var defaultSettingDirs = []string{".", "config", "config/*", "data", "i18n", "static"}
+
+// PathDate is a date of a path pattern, its month and day have two digits:
+// {{.Date.Year}}/{{.Date.Month}}/{{.Date.Day}} is 2022/06/05. Format works too.
+type PathDate struct {
+	time.Time
+}
+
+func (d PathDate) Month() string {
+	return fmt.Sprintf("%02d", int(d.Time.Month()))
+}
+
+func (d PathDate) Day() string {
+	return fmt.Sprintf("%02d", d.Time.Day())
+}
+
+// pagePathData is what the path patterns are given of a page
+type pagePathData struct {
+	ID       string
+	Position string
+	Slug     string
+	Name     string
+	Title    string
+	// Date is when the page was created, Lastmod its Lastmod property
+	Date    PathDate
+	Lastmod PathDate
+	// Section is set for a page with child pages
+	Section bool
+	// Props are the properties of the page by name: text, numbers, booleans or lists of text
+	Props map[string]interface{}
+	// Dir is the folder of the page in the home path, for the media pattern
+	Dir string
+}
+
+// pathPatterns are the templates of the paths of the pages and of their media folders in the home path
+type pathPatterns struct {
+	// page is nil for the default layout
+	page  *template.Template
+	media *template.Template
+}
+
+// newPathPatterns parses the path patterns, nil for the default layout. The slug function
+// makes a path segment of any text, e.g. {{slug .Props.Category}}
+func newPathPatterns(config Markdown, slugs *Slugger) (*pathPatterns, error) {
+	if config.PathPattern == "" && config.MediaPattern == "" {
+		return nil, nil
+	}
+	if config.PathPattern != "" && !strings.HasSuffix(config.PathPattern, ".md") {
+		return nil, fmt.Errorf("pathPattern: %q is not the path of a markdown file", config.PathPattern)
+	}
+	mediaPattern := config.MediaPattern
+	if mediaPattern == "" {
+		mediaPattern = defaultMediaPattern
+	}
+	funcs := template.FuncMap{"slug": func(value interface{}) string {
+		switch v := value.(type) {
+		case nil:
+			return ""
+		case []string:
+			return slugs.Slug(strings.Join(v, " "))
+		}
+		return slugs.Slug(fmt.Sprint(value))
+	}}
+	parse := func(name string, text string) (*template.Template, error) {
+		tpl, err := template.New(name).Funcs(funcs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		if err := tpl.Execute(io.Discard, pagePathData{}); err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		return tpl, nil
+	}
+	patterns := &pathPatterns{}
+	var err error
+	if config.PathPattern != "" {
+		if patterns.page, err = parse("pathPattern", config.PathPattern); err != nil {
+			return nil, err
+		}
+	}
+	if patterns.media, err = parse("mediaPattern", mediaPattern); err != nil {
+		return nil, err
+	}
+	return patterns, nil
+}
+
+// executePathPattern is the path a pattern gives, relative to the home path
+func executePathPattern(tpl *template.Template, data pagePathData) (string, error) {
+	var path strings.Builder
+	if err := tpl.Execute(&path, data); err != nil {
+		return "", fmt.Errorf("%s: %s", tpl.Name(), err)
+	}
+	return filepath.Clean(filepath.FromSlash(strings.TrimSpace(path.String()))), nil
+}
+
+// pathData is the current page for the path patterns
+func (ns *NotionSite) pathData(slug string) pagePathData {
+	prop := ns.currentPageProp
+	data := pagePathData{
+		ID:       ns.currentPage.ID,
+		Position: prop.Position,
+		Slug:     slug,
+		Name:     prop.Name,
+		Title:    prop.GetTitle(),
+		Date:     PathDate{ns.currentPage.CreatedTime},
+		Lastmod:  PathDate{prop.LastMod},
+		Section:  prop.IsSection,
+		Props:    make(map[string]interface{}),
+	}
+	if prop.CreateAt != nil {
+		data.Date = PathDate{*prop.CreateAt}
+	}
+	properties, _ := ns.currentPage.Properties.(notion.DatabasePageProperties)
+	for name, property := range properties {
+		data.Props[name] = propertyValue(property, ns.config.Mention)
+	}
+	return data
+}
+
+// setPatternPaths sets the paths of the current page after the path pattern. A page bundle,
+// index.md, is written to _index.md for a section. A section of a single file pattern is
+// a bundle too, the folder of its child pages is named after the file.
+func (ns *NotionSite) setPatternPaths(slug string) error {
+	rel, err := executePathPattern(ns.paths.page, ns.pathData(slug))
+	if err != nil {
+		return err
+	}
+	dir, name := filepath.Split(rel)
+	if filepath.Ext(name) != ".md" {
+		return fmt.Errorf("pathPattern: %q is not the path of a markdown file", rel)
+	}
+	if name == defaultMarkdownName || name == sectionMarkdownName {
+		name = defaultMarkdownName
+		if ns.currentPageProp.IsSection {
+			name = sectionMarkdownName
+		}
+		ns.files.Slug = filepath.Base(dir)
+	} else if ns.currentPageProp.IsSection {
+		dir = filepath.Join(dir, strings.TrimSuffix(name, ".md"))
+		name = sectionMarkdownName
+		ns.files.Slug = filepath.Base(dir)
+	} else {
+		ns.files.Slug = strings.TrimSuffix(name, ".md")
+	}
+	ns.files.FileFolderPath = filepath.Join(ns.config.HomePath, dir)
+	ns.files.FilePath = filepath.Join(ns.files.FileFolderPath, name)
+	if ns.files.FileName, err = filepath.Rel(filepath.Join(ns.config.HomePath, ns.files.Position), ns.files.FilePath); err != nil {
+		ns.files.FileName = name
+	}
+	return nil
+}
+
+// setMediaPath sets the media folder of the current page after the media pattern, and how
+// the page links it: from the root of the site for a folder in static, or relative to the page
+func (ns *NotionSite) setMediaPath(slug string) error {
+	dir, err := filepath.Rel(ns.config.HomePath, ns.files.FileFolderPath)
+	if err != nil {
+		return err
+	}
+	data := ns.pathData(slug)
+	data.Dir = filepath.ToSlash(dir)
+	rel, err := executePathPattern(ns.paths.media, data)
+	if err != nil {
+		return err
+	}
+	ns.files.MediaPath = filepath.Join(ns.config.HomePath, rel)
+
+	if static, err := filepath.Rel(filepath.Join(ns.config.HomePath, staticDir), ns.files.MediaPath); err == nil && !isOutside(static) {
+		ns.files.mediaFolderLink = "/" + filepath.ToSlash(static)
+		return nil
+	}
+	// the url of a single file page is a folder named after the file
+	page := ns.files.FileFolderPath
+	if name := filepath.Base(ns.files.FilePath); name != defaultMarkdownName && name != sectionMarkdownName {
+		page = strings.TrimSuffix(ns.files.FilePath, ".md")
+	}
+	link, err := filepath.Rel(page, ns.files.MediaPath)
+	if err != nil {
+		return err
+	}
+	ns.files.mediaFolderLink = filepath.ToSlash(link)
+	return nil
+}
+
+// checkInsideHome fails for a path out of the home path: a Position, a FileName or a
+// pattern going up with .. or an absolute path
+func (ns *NotionSite) checkInsideHome(p string) error {
+	home, err := filepath.Abs(ns.config.HomePath)
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(home, abs); err != nil || isOutside(rel) {
+		return fmt.Errorf("page %s: %s is out of the home path %s", ns.currentPage.ID, p, ns.config.HomePath)
+	}
+	return nil
+}
+
+// checkSettingPath fails for a setting file out of the home path or the setting folders: the folders
+// of the home path listed, or matching a listed pattern, e.g. config/*. Their subfolders are not allowed.
+func (ns *NotionSite) checkSettingPath() error {
+	if err := ns.checkInsideHome(ns.files.FilePath); err != nil {
+		return err
+	}
+	dirs := ns.config.SettingDirs
+	if len(dirs) == 0 {
+		dirs = defaultSettingDirs
+	}
+	rel, _ := filepath.Rel(filepath.Clean(ns.config.HomePath), filepath.Clean(ns.files.FilePath))
+	dir := path.Dir(filepath.ToSlash(rel))
+	for _, allowed := range dirs {
+		allowed = path.Clean(allowed)
+		if matched, _ := path.Match(allowed, dir); matched || allowed == dir {
+			return nil
+		}
+	}
+	return fmt.Errorf("page %s: setting file %s is not in a setting folder %v, see markdown.settingDirs", ns.currentPage.ID, rel, dirs)
+}
+
+// isOutside tells whether a relative path goes up out of its base
+func isOutside(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
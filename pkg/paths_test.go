@@ -0,0 +1,57 @@
+package pkg
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPathPattern(t *testing.T) {
+	patterns, err := newPathPatterns(Markdown{
+		PathPattern: "{{.Position}}/{{.Date.Year}}/{{.Date.Month}}/{{slug .Props.Category}}/{{.Slug}}/index.md",
+	}, NewSlugger(Slugs{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := executePathPattern(patterns.page, pagePathData{
+		Position: "content/post",
+		Slug:     "hello",
+		Date:     PathDate{time.Date(2022, 6, 5, 0, 0, 0, 0, time.UTC)},
+		Props:    map[string]interface{}{"Category": "Go Tips"},
+	})
+	if want := filepath.FromSlash("content/post/2022/06/go-tips/hello/index.md"); err != nil || got != want {
+		t.Errorf("got %q %v, want %q", got, err, want)
+	}
+	if _, err := newPathPatterns(Markdown{PathPattern: "{{.Slug}}/index.html"}, NewSlugger(Slugs{})); err == nil {
+		t.Error("a pattern of a html file is accepted")
+	}
+	if _, err := newPathPatterns(Markdown{MediaPattern: "{{.Folder}}"}, NewSlugger(Slugs{})); err == nil {
+		t.Error("a pattern of an unknown field is accepted")
+	}
+}
+
+// TestPathsOutOfHome checks no page is written out of the home path, and setting files only to the setting folders
+func TestPathsOutOfHome(t *testing.T) {
+	config := Config{Markdown: Markdown{HomePath: "site"}}
+	ns := NewNotionSite(nil, New(), NewFiles(config), config, nil)
+	for _, c := range []struct {
+		position, fileName, types string
+		allowed                   bool
+	}{
+		{"content/post", "", "", true},
+		{"../../.github/workflows", "", "", false},
+		{"content/post", "../../../etc/x", "", true},
+		{"", "config.yaml", "setting", true},
+		{"config/_default", "params.toml", "setting", true},
+		{"layouts", "index.html", "setting", false},
+		{"", "../../etc/passwd", "setting", false},
+		{"", ".github/workflows/x.yml", "setting", false},
+	} {
+		ns.currentPageProp = &NotionProp{Name: "Hello", Position: c.position, FileName: c.fileName, Types: c.types}
+		ns.currentPageProp.IsSettingFile = ns.currentPageProp.IsSetting()
+		ns.currentPageProp.IsCustomNameFile = ns.currentPageProp.IsCustomNameMdFile()
+		if err := ns.SetFileInfo(c.position); (err == nil) != c.allowed {
+			t.Errorf("position %q file name %q: %s, allowed %t", c.position, c.fileName, ns.files.FilePath, c.allowed)
+		}
+	}
+}
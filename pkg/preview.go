@@ -0,0 +1,256 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	placeholderLQIP     = "lqip"
+	placeholderBlurhash = "blurhash"
+
+	lqipWidth          = 16
+	previewSampleWidth = 32
+	blurhashX          = 4
+	blurhashY          = 3
+	blurhashCharacters = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+)
+
+// ImagePreview is what shows while an image loads: its dominant color and a tiny blurred copy
+type ImagePreview struct {
+	Color string `json:"color"`
+	// LQIP is a data url of the image 16 pixels wide, the browser blurs it when it scales it up
+	LQIP     string `json:"lqip,omitempty"`
+	Blurhash string `json:"blurhash,omitempty"`
+}
+
+// Placeholder is the lqip data url or the blurhash of the preview
+func (p *ImagePreview) Placeholder(kind string) string {
+	if kind == placeholderBlurhash {
+		return p.Blurhash
+	}
+	return p.LQIP
+}
+
+// ImagePreview returns the preview of a stored image, computed once per file and kind of placeholder.
+// Images other than jpeg, png and gif have none: nil preview.
+func (files *Files) ImagePreview(file string, kind string) (*ImagePreview, error) {
+	if kind != placeholderLQIP && kind != placeholderBlurhash {
+		return nil, fmt.Errorf("unknown image placeholder %q: lqip or blurhash", kind)
+	}
+	// webp and svg images have no decoder here
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+	default:
+		return nil, nil
+	}
+	if files.Media == nil {
+		files.Media = LoadMediaIndex("")
+	}
+	preview := files.Media.Previews[file]
+	if preview != nil && preview.Placeholder(kind) != "" {
+		return preview, nil
+	}
+	raw, err := os.ReadFile(filepath.Join(files.mediaDir(), file))
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode image %s: %s", file, err)
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+
+	if preview == nil {
+		preview = &ImagePreview{}
+	}
+	sample := scaleToWidth(rgba, previewSampleWidth)
+	preview.Color = dominantColor(sample)
+	if kind == placeholderBlurhash {
+		preview.Blurhash = blurhash(sample, blurhashX, blurhashY)
+	} else if preview.LQIP, err = lqip(scaleToWidth(rgba, lqipWidth)); err != nil {
+		return nil, err
+	}
+	files.Media.Previews[file] = preview
+	return preview, nil
+}
+
+// imageSize is the width and height of a stored image, read from its header
+func (files *Files) imageSize(file string) (int, int, error) {
+	f, err := os.Open(filepath.Join(files.mediaDir(), file))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, err
+	}
+	return config.Width, config.Height, nil
+}
+
+// scaleToWidth scales an image down to width, keeping its ratio. Smaller images are kept.
+func scaleToWidth(src *image.RGBA, width int) *image.RGBA {
+	if src.Rect.Dx() <= width {
+		return src
+	}
+	height := int(math.Round(float64(src.Rect.Dy()) * float64(width) / float64(src.Rect.Dx())))
+	if height < 1 {
+		height = 1
+	}
+	return resizeImage(src, width, height)
+}
+
+// lqip is the data url of a tiny copy: a jpeg, or a png when it has transparent pixels
+func lqip(img *image.RGBA) (string, error) {
+	var buf bytes.Buffer
+	mimeType := "image/jpeg"
+	if img.Opaque() {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 60}); err != nil {
+			return "", err
+		}
+	} else {
+		mimeType = "image/png"
+		if err := png.Encode(&buf, img); err != nil {
+			return "", err
+		}
+	}
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// unpremultiply is the color of a pixel, false for a transparent one
+func unpremultiply(img *image.RGBA, x, y int) ([3]float64, bool) {
+	p := img.Pix[img.PixOffset(x, y):]
+	if p[3] == 0 {
+		return [3]float64{}, false
+	}
+	a := float64(p[3])
+	return [3]float64{float64(p[0]) * 255 / a, float64(p[1]) * 255 / a, float64(p[2]) * 255 / a}, true
+}
+
+// dominantColor is the average color of the most common of 512 color buckets: #rrggbb
+func dominantColor(img *image.RGBA) string {
+	var counts [512]int
+	var sums [512][3]float64
+	b := img.Rect
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c, ok := unpremultiply(img, x, y)
+			if !ok {
+				continue
+			}
+			bucket := int(c[0])>>5<<6 | int(c[1])>>5<<3 | int(c[2])>>5
+			counts[bucket]++
+			for i := range c {
+				sums[bucket][i] += c[i]
+			}
+		}
+	}
+	best := 0
+	for bucket, count := range counts {
+		if count > counts[best] {
+			best = bucket
+		}
+	}
+	if counts[best] == 0 {
+		return ""
+	}
+	n := float64(counts[best])
+	return fmt.Sprintf("#%02x%02x%02x", int(sums[best][0]/n+0.5), int(sums[best][1]/n+0.5), int(sums[best][2]/n+0.5))
+}
+
+// blurhash encodes the image as its first x by y cosine components, see https://blurha.sh
+func blurhash(img *image.RGBA, componentsX, componentsY int) string {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	factors := make([][3]float64, 0, componentsX*componentsY)
+	for j := 0; j < componentsY; j++ {
+		for i := 0; i < componentsX; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var factor [3]float64
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := normalisation * math.Cos(math.Pi*float64(i*x)/float64(width)) * math.Cos(math.Pi*float64(j*y)/float64(height))
+					c, _ := unpremultiply(img, img.Rect.Min.X+x, img.Rect.Min.Y+y)
+					for k := range factor {
+						factor[k] += basis * srgbToLinear(c[k])
+					}
+				}
+			}
+			scale := 1 / float64(width*height)
+			for k := range factor {
+				factor[k] *= scale
+			}
+			factors = append(factors, factor)
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encode83((componentsX-1)+(componentsY-1)*9, 1))
+	maximum := 1.0
+	if len(factors) > 1 {
+		actual := 0.0
+		for _, factor := range factors[1:] {
+			for _, v := range factor {
+				actual = math.Max(actual, math.Abs(v))
+			}
+		}
+		quantised := int(math.Max(0, math.Min(82, math.Floor(actual*166-0.5))))
+		maximum = float64(quantised+1) / 166
+		hash.WriteString(encode83(quantised, 1))
+	} else {
+		hash.WriteString(encode83(0, 1))
+	}
+	dc := factors[0]
+	hash.WriteString(encode83(linearToSrgb(dc[0])<<16|linearToSrgb(dc[1])<<8|linearToSrgb(dc[2]), 4))
+	for _, factor := range factors[1:] {
+		var q [3]int
+		for k, v := range factor {
+			q[k] = int(math.Max(0, math.Min(18, math.Floor(signPow(v/maximum, 0.5)*9+9.5))))
+		}
+		hash.WriteString(encode83(q[0]*19*19+q[1]*19+q[2], 2))
+	}
+	return hash.String()
+}
+
+func encode83(value int, length int) string {
+	var b strings.Builder
+	for i := 1; i <= length; i++ {
+		digit := value / int(math.Pow(83, float64(length-i))) % 83
+		b.WriteByte(blurhashCharacters[digit])
+	}
+	return b.String()
+}
+
+func srgbToLinear(value float64) float64 {
+	v := value / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSrgb(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value float64, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
@@ -0,0 +1,86 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dstotijn/go-notion"
+)
+
+func fillImage(width, height int, fill func(x, y int) color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, fill(x, y))
+		}
+	}
+	return img
+}
+
+// TestBlurhash checks the size flag, the average color of a flat image and the number of components
+func TestBlurhash(t *testing.T) {
+	red := fillImage(8, 6, func(int, int) color.RGBA { return color.RGBA{255, 0, 0, 255} })
+	hash := blurhash(red, 4, 3)
+	if len(hash) != 6+2*11 || !strings.HasPrefix(hash, "L") || hash[2:6] != encode83(0xff0000, 4) {
+		t.Errorf("got %s, want L?%s and 11 components", hash, encode83(0xff0000, 4))
+	}
+}
+
+func TestDominantColor(t *testing.T) {
+	img := fillImage(10, 10, func(x, y int) color.RGBA {
+		switch {
+		case x < 3:
+			return color.RGBA{0, 0, 0, 0}
+		case x < 5:
+			return color.RGBA{200, 10, 10, 255}
+		}
+		return color.RGBA{20, 40, 200, 255}
+	})
+	if got := dominantColor(img); got != "#1428c8" {
+		t.Errorf("got %s, want #1428c8", got)
+	}
+}
+
+// TestImagePlaceholderUnprocessed checks the placeholder of an image is shown without the image pipeline
+func TestImagePlaceholderUnprocessed(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, fillImage(20, 10, func(int, int) color.RGBA { return color.RGBA{0, 128, 255, 255} })); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.png"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var resp notion.BlockChildrenResponse
+	if err := json.Unmarshal([]byte(`{"results":[{"object":"block","id":"b1","type":"image",
+		"image":{"type":"file","file":{"url":"media/a.png"},"caption":[]}}]}`), &resp); err != nil {
+		t.Fatal(err)
+	}
+	tm := New()
+	tm.Report = NewReport()
+	tm.NotionProps = &NotionProp{}
+	tm.Config.Image.Placeholder = placeholderLQIP
+	tm.Files = &Files{MediaPath: dir, DefaultMediaFolderName: "media", Media: LoadMediaIndex("")}
+	tm.Files.Media.Blocks[normalizeID("b1")] = "a.png"
+
+	mdb := MdBlock{Block: resp.Results[0], Extra: make(map[string]interface{})}
+	if err := tm.injectImageInfo(resp.Results[0].(*notion.ImageBlock), &mdb.Extra); err != nil {
+		t.Fatal(err)
+	}
+	if err := tm.GenBlock("image", mdb, true); err != nil {
+		t.Fatal(err)
+	}
+	got := tm.ContentBuffer.String()
+	for _, want := range []string{`<img src="media/a.png"`, `width="20" height="10"`, "url(data:image/jpeg;base64,"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("no %s in %s", want, got)
+		}
+	}
+}
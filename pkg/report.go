@@ -0,0 +1,54 @@
+package pkg
+
+import (
+	"fmt"
+)
+
+// Report collects what happened during a run so it can be summarized at the end
+type Report struct {
+	Warnings []string
+	// Changed are the files written with new content, Unchanged counts the files left as they were
+	Changed   []string
+	Unchanged int
+}
+
+func NewReport() *Report {
+	return &Report{}
+}
+
+// Warnf records a warning and prints it right away
+func (r *Report) Warnf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if r == nil {
+		fmt.Println("⚠", msg)
+		return
+	}
+	r.Warnings = append(r.Warnings, msg)
+	fmt.Println("⚠", msg)
+}
+
+// Written records a file written, changed or not
+func (r *Report) Written(path string, changed bool) {
+	if r == nil {
+		return
+	}
+	if changed {
+		r.Changed = append(r.Changed, path)
+	} else {
+		r.Unchanged++
+	}
+}
+
+func (r *Report) Print() {
+	fmt.Printf("✔ %d file(s) changed, %d unchanged\n", len(r.Changed), r.Unchanged)
+	for _, path := range r.Changed {
+		fmt.Println("  -", path)
+	}
+	if len(r.Warnings) == 0 {
+		return
+	}
+	fmt.Printf("⚠ %d warning(s):\n", len(r.Warnings))
+	for _, w := range r.Warnings {
+		fmt.Println("  -", w)
+	}
+}
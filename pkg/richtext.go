@@ -0,0 +1,523 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/dstotijn/go-notion"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// richTextOptions is what rendering rich text needs to know about the site, nil renders it as is
+type richTextOptions struct {
+	resolveLink func(string) string
+	mention     Mention
+}
+
+func (o *richTextOptions) link(link string) string {
+	if o == nil || o.resolveLink == nil {
+		return link
+	}
+	return o.resolveLink(link)
+}
+
+func ConvertRichText(t []notion.RichText) string {
+	return convertRichText(t, nil)
+}
+
+func ConvertRich(t notion.RichText) string {
+	return convertRichText([]notion.RichText{t}, nil)
+}
+
+// convertRichText renders the page content rich text, links are resolved against the current page
+func (tm *ToMarkdown) convertRichText(t []notion.RichText) string {
+	return convertRichText(t, tm.richTextOptions())
+}
+
+func (tm *ToMarkdown) richTextOptions() *richTextOptions {
+	return &richTextOptions{
+		resolveLink: tm.resolveLink,
+		mention:     tm.Config.Mention,
+	}
+}
+
+// convertRichText serializes rich text to markdown. Adjacent runs with the same
+// annotations are merged, emphasis is opened and closed only where the annotations
+// change, whitespace is kept out of the delimiters and falls back to html tags
+// where markdown would not see the delimiters, e.g. next to punctuation.
+func convertRichText(t []notion.RichText, opts *richTextOptions) string {
+	var units []richUnit
+	for _, group := range groupRichRuns(richRuns(t, opts)) {
+		units = append(units, group.unit())
+	}
+	return strings.TrimSpace(renderRichUnits(units))
+}
+
+type richStyle struct {
+	Bold      bool
+	Italic    bool
+	Strike    bool
+	Underline bool
+	Code      bool
+	Color     string
+}
+
+func newRichStyle(a *notion.Annotations) richStyle {
+	if a == nil {
+		return richStyle{}
+	}
+	s := richStyle{
+		Bold:      a.Bold,
+		Italic:    a.Italic,
+		Strike:    a.Strikethrough,
+		Underline: a.Underline,
+		Code:      a.Code,
+	}
+	if _, ok := ColorMap[string(a.Color)]; ok {
+		s.Color = string(a.Color)
+	}
+	return s
+}
+
+// richRun is a piece of text with a single style, raw runs are already markdown
+type richRun struct {
+	text  string
+	raw   bool
+	style richStyle
+	link  string
+}
+
+func richRuns(t []notion.RichText, opts *richTextOptions) []richRun {
+	var runs []richRun
+	for _, rt := range t {
+		run := richRun{style: newRichStyle(rt.Annotations)}
+		switch rt.Type {
+		case notion.RichTextTypeText:
+			if rt.Text == nil {
+				continue
+			}
+			run.text = rt.Text.Content
+			if rt.Text.Link != nil {
+				run.link = opts.link(rt.Text.Link.URL)
+			}
+		case notion.RichTextTypeMention:
+			run.text, run.link = mentionText(rt, opts)
+		case notion.RichTextTypeEquation:
+			if rt.Equation == nil {
+				continue
+			}
+			run.text = "$" + rt.Equation.Expression + "$"
+			run.raw = true
+			run.style.Code = false
+		default:
+			continue
+		}
+		if run.text == "" {
+			continue
+		}
+		// merge with the previous run when nothing but the text differs
+		if n := len(runs); n > 0 && runs[n-1].style == run.style && runs[n-1].link == run.link && runs[n-1].raw == run.raw {
+			runs[n-1].text += run.text
+			continue
+		}
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// richGroup is a run of text, or the runs sharing a link
+type richGroup struct {
+	link string
+	runs []richRun
+}
+
+func groupRichRuns(runs []richRun) []richGroup {
+	var groups []richGroup
+	for _, run := range runs {
+		if n := len(groups); n > 0 && run.link != "" && groups[n-1].link == run.link {
+			groups[n-1].runs = append(groups[n-1].runs, run)
+			continue
+		}
+		groups = append(groups, richGroup{link: run.link, runs: []richRun{run}})
+	}
+	return groups
+}
+
+// unit renders the group into a unit of the outer text. The styles shared by every
+// run of a link wrap the link, the others are rendered inside the brackets.
+func (g richGroup) unit() richUnit {
+	if g.link == "" {
+		return newRichUnit(g.runs[0])
+	}
+	shared := g.runs[0].style
+	for _, run := range g.runs[1:] {
+		shared = intersectStyle(shared, run.style)
+	}
+	var inner []richUnit
+	for _, run := range g.runs {
+		run.style = subtractStyle(run.style, shared)
+		inner = append(inner, newRichUnit(run))
+	}
+	lead, trail := inner[0].lead, inner[len(inner)-1].trail
+	inner[0].lead, inner[len(inner)-1].trail = "", ""
+	text := renderRichUnits(inner)
+	if text == "" {
+		return richUnit{lead: lead + trail, style: shared}
+	}
+	return richUnit{
+		lead:    lead,
+		content: "[" + text + "](" + linkDestination(g.link) + ")",
+		trail:   trail,
+		style:   shared,
+	}
+}
+
+// richUnit is rendered markdown content with its surrounding whitespace kept apart
+type richUnit struct {
+	lead    string
+	content string
+	trail   string
+	style   richStyle
+}
+
+func newRichUnit(run richRun) richUnit {
+	core := strings.TrimLeftFunc(run.text, unicode.IsSpace)
+	lead := run.text[:len(run.text)-len(core)]
+	trimmed := strings.TrimRightFunc(core, unicode.IsSpace)
+	trail := core[len(trimmed):]
+	u := richUnit{lead: lead, trail: trail, style: run.style}
+	switch {
+	case trimmed == "":
+	case run.raw:
+		u.content = trimmed
+	case run.style.Code:
+		u.content = codeSpan(trimmed)
+	default:
+		u.content = escapeMarkdown(trimmed)
+	}
+	u.style.Code = false
+	return u
+}
+
+// richMark is an emphasis that can be opened and closed
+type richMark struct {
+	kind  string
+	color string
+}
+
+const (
+	markColor     = "color"
+	markUnderline = "underline"
+	markStrike    = "strike"
+	markBold      = "bold"
+	markItalic    = "italic"
+)
+
+// marks lists the emphasis of a style from the outermost to the innermost,
+// html tags go outside so markdown delimiters stay next to the text
+func (s richStyle) marks() []richMark {
+	var marks []richMark
+	if s.Color != "" {
+		marks = append(marks, richMark{kind: markColor, color: s.Color})
+	}
+	if s.Underline {
+		marks = append(marks, richMark{kind: markUnderline})
+	}
+	if s.Strike {
+		marks = append(marks, richMark{kind: markStrike})
+	}
+	if s.Bold {
+		marks = append(marks, richMark{kind: markBold})
+	}
+	if s.Italic {
+		marks = append(marks, richMark{kind: markItalic})
+	}
+	return marks
+}
+
+func intersectStyle(a, b richStyle) richStyle {
+	s := richStyle{
+		Bold:      a.Bold && b.Bold,
+		Italic:    a.Italic && b.Italic,
+		Strike:    a.Strike && b.Strike,
+		Underline: a.Underline && b.Underline,
+		Code:      a.Code && b.Code,
+	}
+	if a.Color == b.Color {
+		s.Color = a.Color
+	}
+	return s
+}
+
+func subtractStyle(a, b richStyle) richStyle {
+	s := richStyle{
+		Bold:      a.Bold && !b.Bold,
+		Italic:    a.Italic && !b.Italic,
+		Strike:    a.Strike && !b.Strike,
+		Underline: a.Underline && !b.Underline,
+		Code:      a.Code,
+	}
+	if a.Color != b.Color {
+		s.Color = a.Color
+	}
+	return s
+}
+
+const (
+	pieceText = iota
+	pieceOpen
+	pieceClose
+)
+
+type richPiece struct {
+	kind int
+	text string
+	mark richMark
+	// pair is the index of the matching open or close piece
+	pair int
+	html bool
+}
+
+// delimiter is the markdown delimiter of the piece, empty when it renders as html
+func (p richPiece) delimiter() string {
+	if p.kind == pieceText || p.html {
+		return ""
+	}
+	switch p.mark.kind {
+	case markBold:
+		return "**"
+	case markItalic:
+		return "*"
+	case markStrike:
+		return "~~"
+	}
+	return ""
+}
+
+func (p richPiece) String() string {
+	if p.kind == pieceText {
+		return p.text
+	}
+	if d := p.delimiter(); d != "" {
+		return d
+	}
+	tags := map[string]string{markBold: "strong", markItalic: "em", markStrike: "del", markUnderline: "u", markColor: "span"}
+	tag := tags[p.mark.kind]
+	if p.kind == pieceClose {
+		return "</" + tag + ">"
+	}
+	if p.mark.kind == markColor {
+		cssKey := "color"
+		if strings.HasSuffix(p.mark.color, "_background") {
+			cssKey = "background-color"
+		}
+		return fmt.Sprintf(`<span style="%s: %s;">`, cssKey, ColorMap[p.mark.color])
+	}
+	return "<" + tag + ">"
+}
+
+// renderRichUnits opens and closes the emphasis between the units
+func renderRichUnits(units []richUnit) string {
+	var pieces []richPiece
+	var stack []int
+	var pending string
+	for _, u := range units {
+		pending += u.lead
+		if u.content == "" {
+			pending += u.trail
+			continue
+		}
+		want := u.style.marks()
+		// close everything from the first open mark the unit does not have
+		keep := 0
+		for keep < len(stack) && hasMark(want, pieces[stack[keep]].mark) {
+			keep++
+		}
+		for i := len(stack) - 1; i >= keep; i-- {
+			pieces = append(pieces, richPiece{kind: pieceClose, mark: pieces[stack[i]].mark, pair: stack[i]})
+			pieces[stack[i]].pair = len(pieces) - 1
+		}
+		stack = stack[:keep]
+		pieces = append(pieces, richPiece{kind: pieceText, text: pending})
+		pending = ""
+		for _, m := range want {
+			if stackHasMark(pieces, stack, m) {
+				continue
+			}
+			stack = append(stack, len(pieces))
+			pieces = append(pieces, richPiece{kind: pieceOpen, mark: m})
+		}
+		pieces = append(pieces, richPiece{kind: pieceText, text: u.content})
+		pending = u.trail
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		pieces = append(pieces, richPiece{kind: pieceClose, mark: pieces[stack[i]].mark, pair: stack[i]})
+		pieces[stack[i]].pair = len(pieces) - 1
+	}
+	pieces = append(pieces, richPiece{kind: pieceText, text: pending})
+
+	fallbackToHTML(pieces)
+	var b strings.Builder
+	for _, p := range pieces {
+		b.WriteString(p.String())
+	}
+	return b.String()
+}
+
+func hasMark(marks []richMark, m richMark) bool {
+	for _, mark := range marks {
+		if mark == m {
+			return true
+		}
+	}
+	return false
+}
+
+func stackHasMark(pieces []richPiece, stack []int, m richMark) bool {
+	for _, i := range stack {
+		if pieces[i].mark == m {
+			return true
+		}
+	}
+	return false
+}
+
+// fallbackToHTML renders as html tags the emphasis markdown would not recognize:
+// a delimiter run has to be left-flanking to open and right-flanking to close,
+// see https://spec.commonmark.org/0.30/#left-flanking-delimiter-run
+func fallbackToHTML(pieces []richPiece) {
+	for changed := true; changed; {
+		changed = false
+		var out strings.Builder
+		for i := 0; i < len(pieces); {
+			d := pieces[i].delimiter()
+			if d == "" {
+				out.WriteString(pieces[i].String())
+				i++
+				continue
+			}
+			// the delimiter run is made of the consecutive pieces with the same delimiter character
+			j := i
+			for j < len(pieces) && pieces[j].delimiter() != "" && pieces[j].delimiter()[0] == d[0] {
+				j++
+			}
+			before := lastRune(out.String())
+			after := firstRune(pieces[j:])
+			left, right := leftFlanking(before, after), rightFlanking(before, after)
+			hasClose := false
+			for k := i; k < j; k++ {
+				hasClose = hasClose || pieces[k].kind == pieceClose
+			}
+			for k := i; k < j; k++ {
+				p := pieces[k]
+				// a run both closing and opening is ambiguous, the opening side goes html
+				if (p.kind == pieceOpen && (!left || hasClose)) || (p.kind == pieceClose && !right) {
+					pieces[k].html = true
+					pieces[p.pair].html = true
+					changed = true
+				}
+			}
+			for k := i; k < j; k++ {
+				out.WriteString(pieces[k].String())
+			}
+			i = j
+		}
+	}
+}
+
+func lastRune(s string) rune {
+	if s == "" {
+		return ' '
+	}
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r
+}
+
+func firstRune(pieces []richPiece) rune {
+	for _, p := range pieces {
+		if s := p.String(); s != "" {
+			r, _ := utf8.DecodeRuneInString(s)
+			return r
+		}
+	}
+	return ' '
+}
+
+func isMarkdownPunct(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+func leftFlanking(before, after rune) bool {
+	return !unicode.IsSpace(after) && (!isMarkdownPunct(after) || unicode.IsSpace(before) || isMarkdownPunct(before))
+}
+
+func rightFlanking(before, after rune) bool {
+	return !unicode.IsSpace(before) && (!isMarkdownPunct(before) || unicode.IsSpace(after) || isMarkdownPunct(after))
+}
+
+// escapeMarkdown escapes the characters of plain text markdown or hugo would interpret
+func escapeMarkdown(s string) string {
+	var b strings.Builder
+	lineStart := true
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case strings.ContainsRune("\\`*_[]<>|~", r):
+			b.WriteRune('\\')
+		case r == '{' && i > 0 && runes[i-1] == '{':
+			// hugo shortcode delimiters
+			b.WriteRune('\\')
+		case lineStart && strings.ContainsRune("#+-=", r):
+			b.WriteRune('\\')
+		case lineStart && unicode.IsDigit(r):
+			// ordered list marker: 1. or 1)
+			j := i
+			for j < len(runes) && unicode.IsDigit(runes[j]) {
+				j++
+			}
+			if j < len(runes) && (runes[j] == '.' || runes[j] == ')') {
+				b.WriteString(string(runes[i:j]))
+				b.WriteRune('\\')
+				b.WriteRune(runes[j])
+				lineStart = false
+				i = j
+				continue
+			}
+		}
+		b.WriteRune(r)
+		if r == '\n' {
+			lineStart = true
+		} else if r != ' ' && r != '\t' {
+			lineStart = false
+		}
+	}
+	return b.String()
+}
+
+// codeSpan wraps the text in enough backticks to hold the backticks inside it
+func codeSpan(s string) string {
+	longest, current := 0, 0
+	for _, r := range s {
+		if r == '`' {
+			current++
+			if current > longest {
+				longest = current
+			}
+		} else {
+			current = 0
+		}
+	}
+	fence := strings.Repeat("`", longest+1)
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return fence + s + fence
+}
+
+func linkDestination(link string) string {
+	if strings.ContainsAny(link, " ()") && !strings.HasPrefix(link, "{{") {
+		return "<" + link + ">"
+	}
+	return link
+}
@@ -0,0 +1,51 @@
+package pkg
+
+import (
+	"encoding/json"
+	"flag"
+	"github.com/dstotijn/go-notion"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// TestConvertRichText renders every testdata/richtext/*.json rich text array
+// and compares it with the .golden file next to it, run with -update to rewrite them.
+func TestConvertRichText(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "richtext", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, input := range inputs {
+		input := input
+		name := strings.TrimSuffix(filepath.Base(input), ".json")
+		t.Run(name, func(t *testing.T) {
+			raw, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var richText []notion.RichText
+			if err := json.Unmarshal(raw, &richText); err != nil {
+				t.Fatal(err)
+			}
+			got := ConvertRichText(richText) + "\n"
+
+			golden := strings.TrimSuffix(input, ".json") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
@@ -4,72 +4,270 @@ import (
 	"fmt"
 	"github.com/druidcaesa/gotool"
 	"github.com/dstotijn/go-notion"
-	"github.com/otiai10/opengraph"
+	"html"
+	"net/url"
+	"path"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"time"
 )
 
-// injectBookmarkInfo set bookmark info into the extra map field
+// injectBookmarkInfo set bookmark info into the extra map field, from the opengraph cache
 func (tm *ToMarkdown) injectBookmarkInfo(bookmark *notion.BookmarkBlock, extra *map[string]interface{}) error {
-	og, err := opengraph.Fetch(bookmark.URL)
+	tm.injectLinkCard(bookmark.URL, extra)
+	return nil
+}
+
+// injectLinkPreviewInfo renders a link preview as a link card with its provider, github, slack or figma,
+// for the shortcode to style. It is titled after what the url points to when it can't be fetched
+func (tm *ToMarkdown) injectLinkPreviewInfo(preview *notion.LinkPreviewBlock, extra *map[string]interface{}) error {
+	title, provider := linkPreviewTitle(preview.URL)
+	if !tm.injectLinkCard(preview.URL, extra) && title != "" {
+		(*extra)["Title"] = title
+	}
+	(*extra)["Provider"] = provider
+	return nil
+}
+
+// injectLinkCard sets the card info of a link, it returns false when the metadata is missing
+func (tm *ToMarkdown) injectLinkCard(link string, extra *map[string]interface{}) bool {
+	if tm.OpenGraph == nil {
+		tm.OpenGraph = NewOpenGraphCache(tm.Config.Bookmark)
+	}
+	card, err := tm.OpenGraph.Card(link)
 	if err != nil {
-		return err
+		tm.Report.Warnf("link card %s: %s", link, err)
 	}
-	og.ToAbsURL()
-	for _, img := range og.Image {
-		if img != nil && img.URL != "" {
-			(*extra)["Image"] = img.URL
-			break
+	image, icon := card.Image, card.Icon
+	if tm.Config.Bookmark.DownloadImages {
+		image, icon = tm.downloadCardImage(image), tm.downloadCardImage(icon)
+	}
+	(*extra)["Image"] = image
+	(*extra)["Url"] = card.URL
+	(*extra)["Title"] = card.Title
+	(*extra)["Description"] = card.Description
+	(*extra)["Icon"] = icon
+	return !card.FetchedAt.IsZero()
+}
+
+// injectBreadcrumbInfo sets the sections and the pages above the current one, linked, and the
+// current title. The folder pages have no page to link, they are plain titles.
+func (tm *ToMarkdown) injectBreadcrumbInfo(extra *map[string]interface{}) error {
+	crumbs := make([]map[string]string, 0, len(tm.Trail))
+	for _, crumb := range tm.Trail {
+		link := map[string]interface{}{"Title": crumb.Title, "Url": ""}
+		switch {
+		case crumb.Section != "":
+			if from, err := filepath.Rel(tm.Files.HomePath, tm.Files.FilePath); err == nil {
+				link["Url"] = tm.Links.SectionURL(crumb.Section, filepath.ToSlash(from))
+			}
+		case !crumb.Folder:
+			tm.injectPageLink(crumb.ID, crumb.Title, &link)
 		}
+		crumbs = append(crumbs, map[string]string{
+			"Title": escapeMarkdown(link["Title"].(string)),
+			"Url":   link["Url"].(string),
+		})
 	}
-	(*extra)["Url"] = og.URL
-	(*extra)["Title"] = og.Title
-	(*extra)["Description"] = og.Description
-	(*extra)["Icon"] = og.Favicon
+	(*extra)["Crumbs"] = crumbs
+	(*extra)["Title"] = escapeMarkdown(tm.NotionProps.GetTitle())
 	return nil
 }
 
+// downloadCardImage saves an image of a link card to the media folder, the link is kept when it fails.
+// Offline the image is only taken from the media files stored before.
+func (tm *ToMarkdown) downloadCardImage(link string) string {
+	if link == "" {
+		return ""
+	}
+	if tm.Config.Bookmark.Offline {
+		if path := tm.Files.storedLink(link); path != "" {
+			return path
+		}
+		return link
+	}
+	path, err := tm.Files.download(link, "", "image/")
+	if err != nil {
+		tm.Report.Warnf("couldn't download %s: %s", link, err)
+		return link
+	}
+	return path
+}
+
+// videoTypes are the html5 video types by file extension
+var videoTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".webm": "video/webm",
+	".ogv":  "video/ogg",
+	".mov":  "video/quicktime",
+}
+
+// injectVideoInfo renders a video with the embed provider of its site, uploaded videos are downloaded to the media folder
 func (tm *ToMarkdown) injectVideoInfo(video *notion.VideoBlock, extra *map[string]interface{}) error {
+	(*extra)["Shortcode"] = tm.Config.VideoShortcode
+	if video.Type == notion.FileTypeFile && video.File != nil {
+		(*extra)["Plat"] = "file"
+		(*extra)["Url"] = video.File.URL
+		(*extra)["Type"] = videoType(video.File.URL)
+		return nil
+	}
+	if video.External == nil {
+		return nil
+	}
 	videoUrl := video.External.URL
-	var id, plat string
-	if strings.Contains(videoUrl, "youtube") {
-		plat = "youtube"
-		id = FindUrlContext(RegexYoutube, videoUrl)
+	(*extra)["Url"] = videoUrl
+	// direct links to a video file are played like uploaded ones
+	if t := videoType(videoUrl); t != "" {
+		(*extra)["Plat"] = "file"
+		(*extra)["Type"] = t
+		return nil
+	}
+	embeds, err := tm.embeds()
+	if err != nil {
+		return err
 	}
-	(*extra)["Plat"] = plat
-	(*extra)["Id"] = id
+	html, provider := embeds.Render(videoUrl)
+	(*extra)["Plat"] = provider
+	(*extra)["Html"] = html
 	return nil
 }
 
-func (tm *ToMarkdown) injectEmbedInfo(embed *notion.EmbedBlock, extra *map[string]interface{}) error {
-	var plat = ""
-	url := embed.URL
-	if len(url) == 0 {
-		return nil
+// downloadMedia downloads the file of a media block. A failure is a warning of the run,
+// the block links the placeholder or the url of the file instead.
+func (tm *ToMarkdown) downloadMedia(media any) bool {
+	err := tm.Files.DownloadMedia(media)
+	if err == nil {
+		return true
+	}
+	if block, ok := media.(notion.Block); ok && block.ID() != "" {
+		tm.Report.Warnf("block %s: %s", block.ID(), err)
 	} else {
-		if strings.Contains(url, Bilibili) {
-			url = FindUrlContext(RegexBili, url)
-			plat = "bilibili"
-		}
-		if strings.Contains(url, Jsfiddle) {
-			url = FindUrlContext(RegexJsfiddle, url)
-			plat = "Jsfiddle"
-		}
-		if strings.Contains(url, Twitter) {
-			user := FindUrlContext(RegexTwitterUser, url)
-			url = FindUrlContext(RegexTwitterId, url)
-			plat = "twitter"
-			(*extra)["User"] = user
+		tm.Report.Warnf("%s", err)
+	}
+	return false
+}
+
+// injectImageInfo shows a downloaded image processed with the image pipeline
+// at its width and height, with the srcset of its smaller copies, and its placeholder
+func (tm *ToMarkdown) injectImageInfo(image *notion.ImageBlock, extra *map[string]interface{}) error {
+	if tm.Files.Media == nil {
+		return nil
+	}
+	// the image is processed when it is stored, not when it links its url or the placeholder
+	file := tm.Files.Media.Blocks[normalizeID(image.ID())]
+	var link string
+	if image.Type == notion.FileTypeExternal && image.External != nil {
+		link = image.External.URL
+	} else if image.File != nil {
+		link = image.File.URL
+	}
+	if file == "" || link != tm.Files.mediaLink(file) {
+		return nil
+	}
+	// the caption is the alt text too
+	(*extra)["Caption"] = html.EscapeString(plainText(image.Caption))
+	(*extra)["Shortcode"] = tm.Config.Image.Shortcode
+	if preview := tm.imagePreview(file); preview != nil {
+		(*extra)["Placeholder"] = preview.Placeholder(tm.Config.Image.Placeholder)
+		(*extra)["PlaceholderType"] = tm.Config.Image.Placeholder
+		(*extra)["Color"] = preview.Color
+		// the stored image is shown with its placeholder when it is not processed
+		if width, height, err := tm.Files.imageSize(file); err == nil {
+			(*extra)["Src"] = tm.Files.mediaLink(file)
+			(*extra)["Width"] = width
+			(*extra)["Height"] = height
 		}
-		if strings.Contains(url, Gist) {
-			url = strings.Join(strings.Split(FindTextP(url, Gist), "/"), " ")
-			plat = "gist"
+	}
+	if !tm.Config.Image.Process {
+		return nil
+	}
+	info, err := tm.Files.ProcessImage(file, tm.Config.Image)
+	if err != nil {
+		tm.Report.Warnf("image %s is not processed: %s", file, err)
+		return nil
+	}
+	if info == nil {
+		return nil
+	}
+	(*extra)["Src"] = tm.Files.mediaLink(info.Variants[len(info.Variants)-1].File)
+	(*extra)["Width"] = info.Width
+	(*extra)["Height"] = info.Height
+	(*extra)["Sizes"] = fmt.Sprintf("(max-width: %dpx) 100vw, %dpx", info.Width, info.Width)
+	if len(info.Variants) > 1 {
+		(*extra)["Srcset"] = tm.Files.srcset(info.Variants)
+	}
+	if len(info.WebP) > 0 {
+		(*extra)["WebpSrcset"] = tm.Files.srcset(info.WebP)
+	}
+	return nil
+}
+
+// imagePreview is the preview of a stored image when the images have placeholders
+func (tm *ToMarkdown) imagePreview(file string) *ImagePreview {
+	if tm.Config.Image.Placeholder == "" {
+		return nil
+	}
+	preview, err := tm.Files.ImagePreview(file, tm.Config.Image.Placeholder)
+	if err != nil {
+		tm.Report.Warnf("image %s has no placeholder: %s", file, err)
+		return nil
+	}
+	return preview
+}
+
+// videoType is the html5 type of a link to a video file, empty for other links
+func videoType(videoUrl string) string {
+	if u, err := url.Parse(videoUrl); err == nil {
+		videoUrl = u.Path
+	}
+	return videoTypes[strings.ToLower(path.Ext(videoUrl))]
+}
+
+// injectCodeInfo sets the highlighter language of a code block and the options its caption gives
+func (tm *ToMarkdown) injectCodeInfo(code *notion.CodeBlock, extra *map[string]interface{}) error {
+	cc := parseCodeCaption(plainText(code.Caption))
+	(*extra)["Lang"] = codeLanguage(code.Language, tm.Config.Code.Languages)
+	(*extra)["Fence"] = codeFence(code.RichText)
+	(*extra)["Title"] = cc.Title
+	(*extra)["Attributes"] = cc.attributes()
+	(*extra)["Options"] = cc.highlightOptions()
+	(*extra)["Highlight"] = tm.Config.Code.Render == codeRenderHighlight
+	// a caption without options is kept with its styles
+	caption := cc.Text
+	if cc.Title == "" && cc.HlLines == "" && len(cc.Options) == 0 {
+		caption = tm.convertRichText(code.Caption)
+	}
+	(*extra)["Caption"] = caption
+	return nil
+}
+
+// embeds returns the embed providers of the site, compiled on first use
+func (tm *ToMarkdown) embeds() (*EmbedProviders, error) {
+	if tm.Embeds == nil {
+		embeds, err := NewEmbedProviders(tm.Config.Embeds)
+		if err != nil {
+			return nil, err
 		}
+		tm.Embeds = embeds
+	}
+	return tm.Embeds, nil
+}
 
+// injectEmbedInfo renders an embed with the provider matching its url, others are embedded in an iframe
+func (tm *ToMarkdown) injectEmbedInfo(embed *notion.EmbedBlock, extra *map[string]interface{}) error {
+	if len(embed.URL) == 0 {
+		return nil
 	}
-	(*extra)["Url"] = url
-	(*extra)["Plat"] = plat
+	embeds, err := tm.embeds()
+	if err != nil {
+		return err
+	}
+	html, provider := embeds.Render(embed.URL)
+	(*extra)["Url"] = embed.URL
+	(*extra)["Provider"] = provider
+	(*extra)["Html"] = html
 	return nil
 }
 
@@ -109,14 +307,100 @@ func (tm *ToMarkdown) injectFileInfo(file any, extra *map[string]interface{}) er
 	return nil
 }
 
-func (tm *ToMarkdown) injectCalloutInfo(callout *notion.CalloutBlock, extra *map[string]interface{}) error {
-	var text = ""
-	for _, richText := range callout.RichText {
-		// todo if link ? or change highlight hugo
-		text += richText.Text.Content
-	}
-	(*extra)["Emoji"] = callout.Icon.Emoji
-	(*extra)["Text"] = text
+func (tm *ToMarkdown) injectLinkToPageInfo(link *notion.LinkToPageBlock, extra *map[string]interface{}) error {
+	id := link.PageID
+	if link.Type == notion.LinkToPageTypeDatabaseID {
+		id = link.DatabaseID
+	}
+	tm.injectPageLink(id, "", extra)
+	return nil
+}
+
+// injectChildPageInfo links to the child page, exported in a folder below the current page
+func (tm *ToMarkdown) injectChildPageInfo(child *notion.ChildPageBlock, extra *map[string]interface{}) error {
+	tm.injectPageLink(child.ID(), child.Title, extra)
+	return nil
+}
+
+// injectPageLink sets the Url and Title of a link to a page, the notion url is kept when it is not published
+func (tm *ToMarkdown) injectPageLink(id string, title string, extra *map[string]interface{}) {
+	notionURL := "https://www.notion.so/" + normalizeID(id)
+	if target := tm.Links.Get(id); target != nil && target.Title != "" {
+		title = target.Title
+	}
+	if title == "" {
+		title = notionURL
+	}
+	(*extra)["Url"] = tm.resolveLink(notionURL)
+	(*extra)["Title"] = title
+}
+
+// injectChildDatabaseInfo renders the inline database fetched before, as a table or a data file
+func (tm *ToMarkdown) injectChildDatabaseInfo(child *notion.ChildDatabaseBlock, extra *map[string]interface{}) error {
+	(*extra)["Title"] = child.Title
+	db := tm.Databases[normalizeID(child.ID())]
+	if db == nil {
+		return nil
+	}
+	render := db.View.Render
+	if render == "" {
+		render = databaseRenderTable
+	}
+	(*extra)["Render"] = render
+	(*extra)["Name"] = db.Name()
+	if render == databaseRenderData {
+		path, changed, err := db.WriteData(tm.Files.HomePath, tm.Config.Mention)
+		if err != nil {
+			return fmt.Errorf("couldn't write child database data file: %s", err)
+		}
+		if rel, err := filepath.Rel(tm.Files.HomePath, path); err == nil {
+			path = filepath.ToSlash(rel)
+		}
+		tm.Report.Written(path, changed)
+		fmt.Printf("✔ Child database %s written to %s\n", db.Title, path)
+		return nil
+	}
+	(*extra)["Table"] = db.Table(tm.richTextOptions())
+	return nil
+}
+
+// injectCalloutInfo renders the callout text and children as the body of an admonition of the configured target
+func (tm *ToMarkdown) injectCalloutInfo(mdb *MdBlock) error {
+	callout := mdb.Block.(*notion.CalloutBlock)
+	config := tm.Config.Callout
+	target := config.Target
+	if target == "" {
+		target = calloutTargetHugo
+	}
+	shortcode := config.Shortcode
+	if shortcode == "" {
+		shortcode = defaultCalloutShortcode
+	}
+	children, err := tm.renderChildren(mdb)
+	if err != nil {
+		return err
+	}
+	mdb.Extra["Emoji"] = ""
+	if callout.Icon != nil && callout.Icon.Emoji != nil {
+		mdb.Extra["Emoji"] = *callout.Icon.Emoji
+	}
+	mdb.Extra["Target"] = target
+	mdb.Extra["Shortcode"] = shortcode
+	mdb.Extra["Type"] = targetCalloutType(calloutType(callout, config), target)
+	text := tm.convertRichText(callout.RichText)
+	// the self closing shortcode has the text as a parameter, the children follow it
+	if target == calloutTargetHugo {
+		mdb.Extra["Text"] = strings.ReplaceAll(text, `"`, "&quot;")
+		if children != "" {
+			mdb.Extra["Children"] = calloutBody(children, mdb.Indent, target)
+		}
+		return nil
+	}
+	body := text
+	if children != "" {
+		body += "\n\n" + children
+	}
+	mdb.Extra["Body"] = calloutBody(body, mdb.Indent, target)
 	return nil
 }
 
@@ -137,7 +421,7 @@ func (tm *ToMarkdown) injectFrontMatter(key string, property notion.DatabasePage
 		fmv = opts
 	case []notion.RichText:
 		if prop != nil {
-			fmv = ConvertRichText(prop)
+			fmv = plainText(prop)
 		}
 	case *time.Time:
 		if prop != nil {
@@ -152,13 +436,9 @@ func (tm *ToMarkdown) injectFrontMatter(key string, property notion.DatabasePage
 	case *notion.File:
 		fmv = prop.File.URL
 	case []notion.File:
-		// 最后一个图片最为 banner
-		fmt.Printf("")
-		for i, image := range prop {
-			if i == len(prop)-1 {
-				// todo notion image download real path
-				fmv = fmt.Sprintf("image|%s", image.File.URL)
-			}
+		if len(prop) > 0 {
+			tm.downloadMedia(prop)
+			fmv = fileLinks(prop)
 		}
 	case *notion.FileExternal:
 		fmv = prop.URL
@@ -186,24 +466,85 @@ func (tm *ToMarkdown) injectFrontMatter(key string, property notion.DatabasePage
 	tm.FrontMatter[key] = fmv
 }
 
-func (tm *ToMarkdown) injectFrontMatterCover(cover *notion.Cover) {
-	if cover == nil {
+// injectFrontMatterMedia sets the stored cover as the image of the page, and its icon
+func (tm *ToMarkdown) injectFrontMatterMedia(cover *notion.Cover, icon *notion.Icon) {
+	if link, file := tm.frontMatterMedia(cover); link != "" {
+		tm.FrontMatter["image"] = link
+		tm.injectFrontMatterPreview(file)
+	}
+	if icon != nil && icon.Emoji != nil {
+		tm.FrontMatter["icon"] = *icon.Emoji
+	} else if link, _ := tm.frontMatterMedia(icon); link != "" {
+		tm.FrontMatter["icon"] = link
+	}
+}
+
+// frontMatterMedia downloads the file of a cover or an icon and returns its link and the stored file.
+// The link is empty when the download fails without a placeholder: an expiring notion url is no use
+// in the front matter.
+func (tm *ToMarkdown) frontMatterMedia(media any) (string, string) {
+	files := mediaFiles(media)
+	if len(files) == 0 {
+		return "", ""
+	}
+	source := *files[0].url
+	if !tm.downloadMedia(media) {
+		if tm.Files.Placeholder == "" {
+			return "", ""
+		}
+		return *files[0].url, ""
+	}
+	return *files[0].url, tm.Files.storedFile(source)
+}
+
+// injectFrontMatterPreview sets the placeholder and the color of the image of the page, once
+func (tm *ToMarkdown) injectFrontMatterPreview(file string) {
+	if _, ok := tm.FrontMatter["ImagePlaceholder"]; ok || file == "" {
 		return
 	}
-	image := &notion.FileBlock{
-		Type:     cover.Type,
-		File:     cover.File,
-		External: cover.External,
+	if preview := tm.imagePreview(file); preview != nil {
+		tm.FrontMatter["ImagePlaceholder"] = preview.Placeholder(tm.Config.Image.Placeholder)
+		tm.FrontMatter["ImageColor"] = preview.Color
+	}
+}
+
+// injectFirstImagePreview previews the first image of a page without a cover in the front matter.
+// The front matter is written before the blocks: the image is stored ahead of its block, which
+// finds it stored then.
+func (tm *ToMarkdown) injectFirstImagePreview(blocks []notion.Block) {
+	if tm.Config.Image.Placeholder == "" {
+		return
 	}
-	if err := tm.Files.DownloadMedia(image); err != nil {
+	if _, ok := tm.FrontMatter["ImagePlaceholder"]; ok {
 		return
 	}
-	if image.Type == notion.FileTypeExternal {
-		tm.FrontMatter["image"] = image.External.URL
+	for _, block := range blocks {
+		image, ok := block.(*notion.ImageBlock)
+		if !ok {
+			continue
+		}
+		// the url is copied, the block still links it when it is rendered
+		files := mediaFiles(image)
+		if len(files) == 0 || *files[0].url == "" {
+			return
+		}
+		if _, err := tm.Files.download(*files[0].url, image.ID(), files[0].expect); err == nil {
+			tm.injectFrontMatterPreview(tm.Files.storedFile(*files[0].url))
+		}
+		return
 	}
-	if image.Type == notion.FileTypeFile {
-		tm.FrontMatter["image"] = image.File.URL
+}
+
+// mediaLinks are the links of the files of a files property
+type mediaLinks []string
+
+// fileLinks are the links of the files of a files property
+func fileLinks(files []notion.File) mediaLinks {
+	var links mediaLinks
+	for _, mf := range mediaFiles(files) {
+		links = append(links, *mf.url)
 	}
+	return links
 }
 
 func (tm *ToMarkdown) todo(video any, extra *map[string]interface{}) error {
@@ -213,33 +554,37 @@ func (tm *ToMarkdown) todo(video any, extra *map[string]interface{}) error {
 func (tm *ToMarkdown) inject(mdb *MdBlock, blocks []notion.Block, index int) error {
 	var err error
 	block := mdb.Block
+	// the files of the media blocks are stored before their injectors link them
+	if len(mediaFiles(block)) > 0 {
+		tm.downloadMedia(block)
+	}
 	switch reflect.TypeOf(block) {
 	case reflect.TypeOf(&notion.ImageBlock{}):
-		err = tm.Files.DownloadMedia(block.(*notion.ImageBlock))
+		err = tm.injectImageInfo(block.(*notion.ImageBlock), &mdb.Extra)
 	//todo hugo
 	case reflect.TypeOf(&notion.BookmarkBlock{}):
 		err = tm.injectBookmarkInfo(block.(*notion.BookmarkBlock), &mdb.Extra)
 	case reflect.TypeOf(&notion.VideoBlock{}):
 		err = tm.injectVideoInfo(block.(*notion.VideoBlock), &mdb.Extra)
 	case reflect.TypeOf(&notion.FileBlock{}):
-		err = tm.Files.DownloadMedia(block.(*notion.FileBlock))
 		err = tm.injectFileInfo(block.(*notion.FileBlock), &mdb.Extra)
 	case reflect.TypeOf(&notion.LinkPreviewBlock{}):
-		err = tm.todo(block.(*notion.LinkPreviewBlock), &mdb.Extra)
+		err = tm.injectLinkPreviewInfo(block.(*notion.LinkPreviewBlock), &mdb.Extra)
 	case reflect.TypeOf(&notion.LinkToPageBlock{}):
-		err = tm.todo(block.(*notion.LinkToPageBlock), &mdb.Extra)
+		err = tm.injectLinkToPageInfo(block.(*notion.LinkToPageBlock), &mdb.Extra)
+	case reflect.TypeOf(&notion.CodeBlock{}):
+		err = tm.injectCodeInfo(block.(*notion.CodeBlock), &mdb.Extra)
 	case reflect.TypeOf(&notion.EmbedBlock{}):
 		err = tm.injectEmbedInfo(block.(*notion.EmbedBlock), &mdb.Extra)
 	case reflect.TypeOf(&notion.CalloutBlock{}):
-		err = tm.injectCalloutInfo(block.(*notion.CalloutBlock), &mdb.Extra)
+		err = tm.injectCalloutInfo(mdb)
 	case reflect.TypeOf(&notion.BreadcrumbBlock{}):
-		err = tm.todo(block.(*notion.BreadcrumbBlock), &mdb.Extra)
+		err = tm.injectBreadcrumbInfo(&mdb.Extra)
 	case reflect.TypeOf(&notion.ChildDatabaseBlock{}):
-		err = tm.todo(block.(*notion.ChildDatabaseBlock), &mdb.Extra)
+		err = tm.injectChildDatabaseInfo(block.(*notion.ChildDatabaseBlock), &mdb.Extra)
 	case reflect.TypeOf(&notion.ChildPageBlock{}):
-		err = tm.todo(block.(*notion.ChildPageBlock), &mdb.Extra)
+		err = tm.injectChildPageInfo(block.(*notion.ChildPageBlock), &mdb.Extra)
 	case reflect.TypeOf(&notion.PDFBlock{}):
-		err = tm.Files.DownloadMedia(block.(*notion.PDFBlock))
 		err = tm.injectFileInfo(block.(*notion.PDFBlock), &mdb.Extra)
 	case reflect.TypeOf(&notion.SyncedBlock{}):
 		err = tm.todo(block.(*notion.SyncedBlock), &mdb.Extra)
@@ -247,6 +592,10 @@ func (tm *ToMarkdown) inject(mdb *MdBlock, blocks []notion.Block, index int) err
 		err = tm.todo(block.(*notion.TemplateBlock), &mdb.Extra)
 	case reflect.TypeOf(&notion.AudioBlock{}):
 		err = tm.injectFileInfo(block.(*notion.AudioBlock), &mdb.Extra)
+	case reflect.TypeOf(&notion.Heading1Block{}), reflect.TypeOf(&notion.Heading2Block{}), reflect.TypeOf(&notion.Heading3Block{}):
+		mdb.Extra["Anchor"] = tm.Anchors.Get(block.ID())
+	case reflect.TypeOf(&notion.TableOfContentsBlock{}):
+		mdb.Extra["Anchors"] = tm.Anchors.List()
 	case reflect.TypeOf(&notion.ToDoBlock{}):
 		mdb.Block = block.(*notion.ToDoBlock)
 	case reflect.TypeOf(&notion.TableBlock{}):
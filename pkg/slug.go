@@ -0,0 +1,222 @@
+package pkg
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const defaultSlugMaxLength = 80
+
+// Slugger names the pages in their paths and keeps two pages from being written to the same path
+type Slugger struct {
+	config  Slugs
+	keepCJK bool
+	// claimed are the ids of the pages by lowercased path, the paths of a case insensitive file system collide too
+	claimed map[string]string
+}
+
+func NewSlugger(config Slugs) *Slugger {
+	if config.MaxLength <= 0 {
+		config.MaxLength = defaultSlugMaxLength
+	}
+	keepCJK := config.KeepCJK == nil || *config.KeepCJK
+	return &Slugger{config: config, keepCJK: keepCJK, claimed: make(map[string]string)}
+}
+
+// Slug is the title in lowercase latin letters, digits and dashes: the accents are dropped, the
+// cyrillic and greek letters are transliterated. The cjk characters are kept, or the kana and the
+// hangul are romanized and the han characters, which need a dictionary, are dropped. The letters
+// of other scripts are kept.
+// Everything else, slashes, punctuation and emoji, separates the words.
+func (s *Slugger) Slug(title string) string {
+	var b strings.Builder
+	runes := []rune(strings.TrimSpace(title))
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		t, transliterated := transliterations[unicode.ToLower(r)]
+		switch {
+		case isCJK(r) && s.keepCJK:
+			b.WriteRune(r)
+		case isKana(r):
+			start := i
+			for i+1 < len(runes) && isKana(runes[i+1]) {
+				i++
+			}
+			b.WriteString("-" + romanizeKana(runes[start:i+1]) + "-")
+		case r >= hangulFirst && r <= hangulLast:
+			b.WriteString(romanizeHangul(r))
+		case isCJK(r):
+			b.WriteByte('-')
+		case r == '\'' || r == '’':
+			// don't is dont, not don-t
+		case transliterated:
+			// before the accents are dropped too: й is y, not i
+			b.WriteString(t)
+		default:
+			for _, d := range norm.NFKD.String(string(r)) {
+				if unicode.Is(unicode.Mn, d) {
+					continue
+				}
+				d = unicode.ToLower(d)
+				if t, ok := transliterations[d]; ok {
+					b.WriteString(t)
+				} else if d < unicode.MaxASCII && (d >= 'a' && d <= 'z' || d >= '0' && d <= '9') || d > unicode.MaxASCII && (unicode.IsLetter(d) || unicode.IsDigit(d)) {
+					b.WriteRune(d)
+				} else {
+					b.WriteByte('-')
+				}
+			}
+		}
+	}
+	return s.trim(b.String())
+}
+
+// trim collapses the dashes and cuts the slug at the max length, at a dash when there is one in its second half
+func (s *Slugger) trim(slug string) string {
+	parts := strings.FieldsFunc(slug, func(r rune) bool { return r == '-' })
+	runes := []rune(strings.Join(parts, "-"))
+	if len(runes) <= s.config.MaxLength {
+		return string(runes)
+	}
+	runes = runes[:s.config.MaxLength]
+	for i := len(runes) - 1; i > len(runes)/2; i-- {
+		if runes[i] == '-' {
+			runes = runes[:i]
+			break
+		}
+	}
+	return strings.Trim(string(runes), "-")
+}
+
+// Claim records a path as the path of a page. It returns the page written there already, empty when
+// the path is free or is the path of the page already.
+func (s *Slugger) Claim(path string, pageID string) string {
+	key := strings.ToLower(path)
+	if owner, ok := s.claimed[key]; ok && owner != pageID {
+		return owner
+	}
+	s.claimed[key] = pageID
+	return ""
+}
+
+// Claimed tells whether a path is the path of a page already
+func (s *Slugger) Claimed(path string) bool {
+	_, ok := s.claimed[strings.ToLower(path)]
+	return ok
+}
+
+// shortID is the first 8 characters of a page id, it tells apart the pages of the same slug
+func shortID(id string) string {
+	id = normalizeID(id)
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) || r == 'ー'
+}
+
+func isKana(r rune) bool {
+	return unicode.In(r, unicode.Hiragana, unicode.Katakana) || r == 'ー'
+}
+
+const (
+	hangulFirst = 0xac00
+	hangulLast  = 0xd7a3
+)
+
+var (
+	hangulInitials = strings.Split("g kk n d tt r m b pp s ss  j jj ch k t p h", " ")
+	hangulVowels   = strings.Split("a ae ya yae eo e yeo ye o wa wae oe yo u wo we wi yu eu ui i", " ")
+	hangulFinals   = strings.Split(" k k k n n n t l k m l l l p l m p p t t ng t t k t p t", " ")
+)
+
+// romanizeHangul romanizes a hangul syllable after the revised romanization, without the changes
+// a syllable makes to the next one
+func romanizeHangul(r rune) string {
+	i := int(r - hangulFirst)
+	return hangulInitials[i/(21*28)] + hangulVowels[i/28%21] + hangulFinals[i%28]
+}
+
+var hiragana = map[rune]string{}
+
+func init() {
+	rows := []struct {
+		kana   string
+		romaji string
+	}{
+		{"あいうえお", "a i u e o"}, {"かきくけこ", "ka ki ku ke ko"}, {"がぎぐげご", "ga gi gu ge go"},
+		{"さしすせそ", "sa shi su se so"}, {"ざじずぜぞ", "za ji zu ze zo"}, {"たちつてと", "ta chi tsu te to"},
+		{"だぢづでど", "da ji zu de do"}, {"なにぬねの", "na ni nu ne no"}, {"はひふへほ", "ha hi fu he ho"},
+		{"ばびぶべぼ", "ba bi bu be bo"}, {"ぱぴぷぺぽ", "pa pi pu pe po"}, {"まみむめも", "ma mi mu me mo"},
+		{"やゆよ", "ya yu yo"}, {"らりるれろ", "ra ri ru re ro"}, {"わゐゑをん", "wa i e o n"},
+		{"ぁぃぅぇぉ", "a i u e o"}, {"ゎゔゕゖ", "wa vu ka ke"},
+	}
+	for _, row := range rows {
+		romaji := strings.Split(row.romaji, " ")
+		for i, r := range []rune(row.kana) {
+			hiragana[r] = romaji[i]
+		}
+	}
+}
+
+// romanizeKana romanizes a run of hiragana and katakana after hepburn: きゃ is kya, しゃ sha, っと tto
+func romanizeKana(kana []rune) string {
+	var out string
+	double := false
+	for _, r := range kana {
+		if r >= 'ァ' && r <= 'ヶ' {
+			r -= 'ァ' - 'ぁ'
+		}
+		switch r {
+		case 'ー':
+			continue
+		case 'っ':
+			double = true
+			continue
+		case 'ゃ', 'ゅ', 'ょ':
+			vowel := map[rune]string{'ゃ': "a", 'ゅ': "u", 'ょ': "o"}[r]
+			switch {
+			case strings.HasSuffix(out, "shi") || strings.HasSuffix(out, "chi") || strings.HasSuffix(out, "ji"):
+				out = strings.TrimSuffix(out, "i") + vowel
+			case strings.HasSuffix(out, "i") && len(out) > 1:
+				out = strings.TrimSuffix(out, "i") + "y" + vowel
+			default:
+				out += "y" + vowel
+			}
+			continue
+		}
+		romaji, ok := hiragana[r]
+		if !ok {
+			out += "-"
+			double = false
+			continue
+		}
+		if double && strings.IndexByte("aiueon", romaji[0]) < 0 {
+			if strings.HasPrefix(romaji, "ch") {
+				out += "t"
+			} else {
+				out += romaji[:1]
+			}
+		}
+		double = false
+		out += romaji
+	}
+	return out
+}
+
+// transliterations are the letters which are not a latin letter with accents
+var transliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'ł': "l", 'đ': "d", 'ð': "d", 'þ': "th", 'ı': "i", 'ŋ': "ng",
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh", 'з': "z", 'и': "i",
+	'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t",
+	'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "",
+	'э': "e", 'ю': "yu", 'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g", 'ў': "u",
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th", 'ι': "i", 'κ': "k",
+	'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t",
+	'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+}
@@ -0,0 +1,53 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSlug(t *testing.T) {
+	keep := false
+	slugs := NewSlugger(Slugs{KeepCJK: &keep})
+	cases := map[string]string{
+		"Hello World":                "hello-world",
+		"  What's new in Go 1.19?  ": "whats-new-in-go-1-19",
+		"a/b: c#d":                   "a-b-c-d",
+		"Crème brûlée & Straße":      "creme-brulee-strasse",
+		"🚀 Launch 🎉":                 "launch",
+		"Привет, мир":                "privet-mir",
+		"Ελληνικά":                   "ellinika",
+		"東京タワーとちょっと":                 "tawatochotto",
+		"한국어 공부":                     "hangukeo-gongbu",
+		"你好 world":                   "world",
+		"ｆｕｌｌ　ｗｉｄｔｈ":                 "full-width",
+		strings.Repeat("word ", 30):  strings.TrimSuffix(strings.Repeat("word-", 16), "-"),
+	}
+	for title, want := range cases {
+		if got := slugs.Slug(title); got != want {
+			t.Errorf("%q: got %q, want %q", title, got, want)
+		}
+	}
+	// the cjk characters are kept by default, as before the slugs
+	for title, want := range map[string]string{"你好 World": "你好-world", "中文标题": "中文标题", "東京タワー": "東京タワー"} {
+		if got := NewSlugger(Slugs{}).Slug(title); got != want {
+			t.Errorf("%q: got %q, want %q", title, got, want)
+		}
+	}
+	if got := slugs.Slug("中文标题"); got != "" {
+		t.Errorf("got %q, want the han characters dropped", got)
+	}
+}
+
+// TestClaim checks a page keeps its path, the next page of the same path gets another one
+func TestClaim(t *testing.T) {
+	slugs := NewSlugger(Slugs{})
+	if owner := slugs.Claim("content/post/hello", "a"); owner != "" {
+		t.Errorf("free path owned by %s", owner)
+	}
+	if owner := slugs.Claim("content/post/Hello", "b"); owner != "a" {
+		t.Errorf("taken path owned by %q, want a", owner)
+	}
+	if owner := slugs.Claim("content/post/hello", "a"); owner != "" {
+		t.Errorf("path of the page owned by %s", owner)
+	}
+}
@@ -0,0 +1,274 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	storageLocal = "local"
+	storageS3    = "s3"
+
+	defaultStorageDir    = ".notion-site/media"
+	defaultS3Region      = "us-east-1"
+	defaultS3Timeout     = 60 * time.Second
+	s3EmptyPayloadSha256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// MediaStorage is where the media files end up. They are written to a local folder first,
+// named after the hash of their content, then stored.
+type MediaStorage interface {
+	// Dir is the folder the files are written to, empty for the media folder of each page
+	Dir() string
+	// Store keeps a file written to Dir, a file stored already is skipped
+	Store(file string, contentType string) error
+	// Key is the path of a stored file from the root of the storage, empty for files next to the page
+	Key(file string) string
+	// URL links a stored file, empty to link it relative to the page
+	URL(file string) string
+}
+
+// NewMediaStorage returns the storage of the config, local by default
+func NewMediaStorage(config Storage) (MediaStorage, error) {
+	switch config.Type {
+	case "", storageLocal:
+		return LocalStorage{}, nil
+	case storageS3:
+		return NewS3Storage(config)
+	}
+	return nil, fmt.Errorf("unknown media storage %q: local or s3", config.Type)
+}
+
+// LocalStorage keeps the media files in the media folder of the page, next to the markdown
+type LocalStorage struct{}
+
+func (LocalStorage) Dir() string                { return "" }
+func (LocalStorage) Store(string, string) error { return nil }
+func (LocalStorage) Key(string) string          { return "" }
+func (LocalStorage) URL(string) string          { return "" }
+
+// S3Storage uploads the media files to an s3 compatible bucket, signed with aws signature v4.
+// The credentials are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+type S3Storage struct {
+	config       Storage
+	endpoint     *url.URL
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+	// stored are the keys known to be in the bucket
+	stored map[string]bool
+	now    func() time.Time
+}
+
+func NewS3Storage(config Storage) (*S3Storage, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, fmt.Errorf("s3 storage needs an endpoint and a bucket")
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("s3 storage endpoint %q is not a url", config.Endpoint)
+	}
+	s := &S3Storage{
+		config:       config,
+		endpoint:     endpoint,
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		client:       &http.Client{Timeout: defaultS3Timeout},
+		stored:       make(map[string]bool),
+		now:          time.Now,
+	}
+	if s.accessKey == "" || s.secretKey == "" {
+		return nil, fmt.Errorf("s3 storage needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if s.config.Region == "" {
+		s.config.Region = os.Getenv("AWS_REGION")
+	}
+	if s.config.Region == "" {
+		s.config.Region = defaultS3Region
+	}
+	if s.config.Dir == "" {
+		s.config.Dir = defaultStorageDir
+	}
+	return s, nil
+}
+
+func (s *S3Storage) Dir() string {
+	return s.config.Dir
+}
+
+func (s *S3Storage) Key(file string) string {
+	return strings.TrimLeft(path.Join(s.config.Prefix, file), "/")
+}
+
+// URL is the public url of the bucket the key is appended to, or the object url on the endpoint
+func (s *S3Storage) URL(file string) string {
+	if s.config.PublicURL != "" {
+		return strings.TrimRight(s.config.PublicURL, "/") + "/" + s.Key(file)
+	}
+	return s.objectURL(s.Key(file)).String()
+}
+
+// Store uploads a file unless an object with its name, the hash of its content, is in the bucket already
+func (s *S3Storage) Store(file string, contentType string) error {
+	key := s.Key(file)
+	if s.stored[key] {
+		return nil
+	}
+	exists, err := s.exists(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := s.put(key, filepath.Join(s.config.Dir, file), contentType); err != nil {
+			return err
+		}
+	}
+	s.stored[key] = true
+	return nil
+}
+
+// objectURL is the path style url of an object: endpoint/bucket/key
+func (s *S3Storage) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	u.Path = strings.TrimRight(u.Path, "/") + "/" + s.config.Bucket + "/" + key
+	u.RawPath = ""
+	return &u
+}
+
+func (s *S3Storage) exists(key string) (bool, error) {
+	req, err := http.NewRequest(http.MethodHead, s.objectURL(key).String(), nil)
+	if err != nil {
+		return false, err
+	}
+	s.sign(req, s3EmptyPayloadSha256)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("s3 head %s: %s", key, resp.Status)
+}
+
+func (s *S3Storage) put(key string, localPath string, contentType string) error {
+	raw, err := os.ReadFile(localPath)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, s.objectURL(key).String(), bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	sum := sha256.Sum256(raw)
+	s.sign(req, hex.EncodeToString(sum[:]))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("s3 put %s: %s %s", key, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// sign adds the aws signature v4 authorization to the request, signing the host and all its headers
+func (s *S3Storage) sign(req *http.Request, payloadHash string) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3Escape(req.URL.Path, true),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s.config.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + s.secretKey)
+	for _, part := range []string{date, s.config.Region, "s3", "aws4_request"} {
+		key = hmacSha256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	var pairs []string
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(name, false)+"="+s3Escape(value, false))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// s3Escape percent encodes all but the unreserved characters, and the slashes of a path
+func s3Escape(s string, path bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~", c) >= 0 || path && c == '/' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
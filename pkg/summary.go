@@ -0,0 +1,102 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dstotijn/go-notion"
+)
+
+const (
+	summaryBreakBlocks    = "blocks"
+	summaryBreakParagraph = "paragraph"
+	summaryBreakDivider   = "divider"
+	summaryBreakMarker    = "marker"
+	summaryBreakNone      = "none"
+
+	moreTag = "<!--more-->"
+)
+
+// summaryBreak places the <!--more--> separator of a page between two top level blocks
+type summaryBreak struct {
+	config  Summaries
+	blocks  int
+	done    bool
+	pending bool
+}
+
+// checkSummaryBreak fails for an unknown summary.break, which would never place the separator
+func checkSummaryBreak(config Summaries) error {
+	switch config.Break {
+	case "", summaryBreakParagraph, summaryBreakBlocks, summaryBreakDivider, summaryBreakMarker, summaryBreakNone:
+		return nil
+	}
+	return fmt.Errorf("unknown summary.break %q: paragraph, blocks, divider, marker or none", config.Break)
+}
+
+// newSummaryBreak returns the summary break of the page, nil when it has none
+func newSummaryBreak(config Summaries) *summaryBreak {
+	if config.Break == summaryBreakNone {
+		return nil
+	}
+	if config.Break == "" {
+		config.Break = summaryBreakParagraph
+	}
+	if config.Blocks <= 0 {
+		config.Blocks = 1
+	}
+	if config.Marker == "" {
+		config.Marker = moreTag
+	}
+	return &summaryBreak{config: config}
+}
+
+// replaces tells whether the block is the divider or marker paragraph standing for the separator
+func (sb *summaryBreak) replaces(block notion.Block) bool {
+	if sb == nil || sb.done {
+		return false
+	}
+	switch sb.config.Break {
+	case summaryBreakDivider:
+		_, ok := block.(*notion.DividerBlock)
+		sb.done, sb.pending = ok, ok
+		return ok
+	case summaryBreakMarker:
+		p, ok := block.(*notion.ParagraphBlock)
+		ok = ok && strings.TrimSpace(plainText(p.RichText)) == sb.config.Marker
+		sb.done, sb.pending = ok, ok
+		return ok
+	}
+	return false
+}
+
+// after counts a rendered block, the separator goes after the first paragraph or the first N blocks
+func (sb *summaryBreak) after(block notion.Block) {
+	if sb == nil || sb.done {
+		return
+	}
+	switch sb.config.Break {
+	case summaryBreakParagraph:
+		if p, ok := block.(*notion.ParagraphBlock); ok && strings.TrimSpace(plainText(p.RichText)) != "" {
+			sb.done, sb.pending = true, true
+		}
+	case summaryBreakBlocks:
+		sb.blocks++
+		if sb.blocks >= sb.config.Blocks {
+			sb.done, sb.pending = true, true
+		}
+	}
+}
+
+// write writes the pending separator before the next block, unless it would split a list
+func (sb *summaryBreak) write(w io.Writer, last notion.Block, next notion.Block) {
+	if sb == nil || !sb.pending {
+		return
+	}
+	if last != nil && isListItem(last) && isListItem(next) {
+		return
+	}
+	sb.pending = false
+	io.WriteString(w, moreTag+"\n\n")
+}
@@ -2,29 +2,12 @@ package pkg
 
 import (
 	"github.com/dlclark/regexp2"
+	"github.com/dstotijn/go-notion"
 	"reflect"
 	"strings"
 	"unicode"
 )
 
-const Gist = "gist.github.com"
-const Twitter = "twitter.com"
-const Jsfiddle = "jsfiddle.net"
-const Bilibili = "bilibili.com"
-const RegexBili = `((?<=\.com\/video\/).*(?=\/))|((?<=bvid=).*(?=&cid?))`
-const RegexYoutube = `(?<=\.com\/watch\?v=).*`
-const RegexTwitterId = `(?<=status\/).*(?=\?)`
-const RegexTwitterUser = `(?<=com\/).*(?=\/status)`
-const RegexJsfiddle = `(?<=jsfiddle\.net\/).*(?=\/)`
-
-func FindTextP(ori string, pre string) string {
-	ori = strings.ReplaceAll(strings.TrimSpace(ori), "https://", "")
-	ori = strings.ReplaceAll(strings.TrimSpace(ori), "http://", "")
-	preI := strings.Index(ori, pre)
-	ori = ori[preI+len(pre):]
-	return ori
-}
-
 func FindUrlContext(regex string, url string) string {
 	var res string
 	reg, _ := regexp2.Compile(regex, 0)
@@ -57,3 +40,40 @@ func GetBlockType(block any) string {
 	blockType := strings.Replace(reflect.TypeOf(block).String(), "*notion.", "", -1)
 	return CamelCaseToUnderscore(strings.ReplaceAll(blockType, "Block", ""))
 }
+
+// blockChildren returns the already fetched children of a block
+func blockChildren(block notion.Block) []notion.Block {
+	switch b := block.(type) {
+	case *notion.ParagraphBlock:
+		return b.Children
+	case *notion.QuoteBlock:
+		return b.Children
+	case *notion.ToggleBlock:
+		return b.Children
+	case *notion.CalloutBlock:
+		return b.Children
+	case *notion.BulletedListItemBlock:
+		return b.Children
+	case *notion.NumberedListItemBlock:
+		return b.Children
+	case *notion.ToDoBlock:
+		return b.Children
+	case *notion.CodeBlock:
+		return b.Children
+	case *notion.ColumnBlock:
+		return b.Children
+	case *notion.TableBlock:
+		return b.Children
+	case *notion.SyncedBlock:
+		return b.Children
+	case *notion.TemplateBlock:
+		return b.Children
+	case *notion.Heading1Block:
+		return b.Children
+	case *notion.Heading2Block:
+		return b.Children
+	case *notion.Heading3Block:
+		return b.Children
+	}
+	return nil
+}
@@ -0,0 +1,571 @@
+package pkg
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"math/bits"
+)
+
+// The lossless webp (VP8L) encoder of the image pipeline: subtract green and predictor transforms,
+// LZ77 backward references and a single set of prefix codes. Lossy webp and avif need cgo encoders.
+const (
+	vp8lSignature      = 0x2f
+	vp8lMaxSize        = 1 << 14
+	vp8lPredictorBits  = 4
+	vp8lMaxLength      = 4096
+	vp8lMaxDistance    = 1<<20 - 120
+	vp8lMinMatch       = 3
+	vp8lMaxChain       = 32
+	vp8lHashBits       = 16
+	vp8lMaxCodeLength  = 15
+	vp8lMaxCodeLengthC = 7
+	vp8lNumLengthCodes = 24
+	vp8lNumDistCodes   = 40
+)
+
+// vp8lCodeLengthOrder is the order the lengths of the code length code are written in
+var vp8lCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// vp8lPredictors are the predictor modes tried per tile: left, top, average of both and select
+var vp8lPredictors = []uint32{1, 2, 7, 11}
+
+// encodeWebP writes the image as a lossless webp
+func encodeWebP(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > vp8lMaxSize || height > vp8lMaxSize {
+		return fmt.Errorf("webp: unsupported size %dx%d", width, height)
+	}
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok || nrgba.Rect.Min != (image.Point{}) {
+		nrgba = image.NewNRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(nrgba, nrgba.Rect, img, b.Min, draw.Src)
+	}
+	argb := make([]uint32, width*height)
+	alpha := false
+	for y := 0; y < height; y++ {
+		row := nrgba.Pix[y*nrgba.Stride : y*nrgba.Stride+width*4]
+		for x := 0; x < width; x++ {
+			p := row[x*4 : x*4+4]
+			argb[y*width+x] = uint32(p[3])<<24 | uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+			alpha = alpha || p[3] != 0xff
+		}
+	}
+
+	bw := &vp8lWriter{}
+	bw.write(vp8lSignature, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if alpha {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3)
+
+	// the decoder undoes the transforms in reverse order: predictor then subtract green
+	vp8lSubtractGreen(argb)
+	bw.write(1, 1)
+	bw.write(2, 2)
+	modes, tilesX, tilesY := vp8lPredict(argb, width, height)
+	bw.write(1, 1)
+	bw.write(0, 2)
+	bw.write(vp8lPredictorBits-2, 3)
+	vp8lWriteImage(bw, modes, tilesX, tilesY, false)
+	bw.write(0, 1)
+	vp8lWriteImage(bw, argb, width, height, true)
+	data := bw.flush()
+
+	pad := len(data) & 1
+	header := make([]byte, 20)
+	copy(header, "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+len(data)+pad))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if pad == 1 {
+		data = append(data, 0)
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+type vp8lWriter struct {
+	buf  []byte
+	bits uint64
+	n    uint
+}
+
+// write appends the n low bits of v, least significant first
+func (bw *vp8lWriter) write(v uint32, n uint) {
+	bw.bits |= uint64(v&(1<<n-1)) << bw.n
+	bw.n += n
+	for bw.n >= 8 {
+		bw.buf = append(bw.buf, byte(bw.bits))
+		bw.bits >>= 8
+		bw.n -= 8
+	}
+}
+
+func (bw *vp8lWriter) flush() []byte {
+	if bw.n > 0 {
+		bw.buf = append(bw.buf, byte(bw.bits))
+		bw.bits, bw.n = 0, 0
+	}
+	return bw.buf
+}
+
+func vp8lSubtractGreen(argb []uint32) {
+	for i, p := range argb {
+		g := (p >> 8) & 0xff
+		r := ((p >> 16) - g) & 0xff
+		b := (p - g) & 0xff
+		argb[i] = p&0xff00ff00 | r<<16 | b
+	}
+}
+
+// vp8lPredict replaces the pixels by their residuals, with the mode of each tile
+// picked by the smallest residuals, and returns the modes as an image
+func vp8lPredict(argb []uint32, width, height int) ([]uint32, int, int) {
+	size := 1 << vp8lPredictorBits
+	tilesX, tilesY := (width+size-1)/size, (height+size-1)/size
+	modes := make([]uint32, tilesX*tilesY)
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			best, bestCost := vp8lPredictors[0], -1
+			for _, mode := range vp8lPredictors {
+				cost := 0
+				for y := ty * size; y < height && y < (ty+1)*size; y++ {
+					for x := tx * size; x < width && x < (tx+1)*size; x++ {
+						cost += vp8lResidualCost(vp8lSub(argb[y*width+x], vp8lPrediction(argb, width, x, y, mode)))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+			modes[ty*tilesX+tx] = 0xff000000 | best<<8
+		}
+	}
+	// the residuals are computed from the original neighbors, from the last pixel back
+	for i := len(argb) - 1; i >= 0; i-- {
+		x, y := i%width, i/width
+		mode := modes[(y>>vp8lPredictorBits)*tilesX+x>>vp8lPredictorBits] >> 8 & 0xff
+		argb[i] = vp8lSub(argb[i], vp8lPrediction(argb, width, x, y, mode))
+	}
+	return modes, tilesX, tilesY
+}
+
+func vp8lPrediction(argb []uint32, width, x, y int, mode uint32) uint32 {
+	i := y*width + x
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return argb[i-1]
+	case x == 0:
+		return argb[i-width]
+	}
+	l, t, tl := argb[i-1], argb[i-width], argb[i-width-1]
+	switch mode {
+	case 1:
+		return l
+	case 2:
+		return t
+	case 7:
+		return vp8lAverage(l, t)
+	case 11:
+		return vp8lSelect(l, t, tl)
+	}
+	return 0xff000000
+}
+
+func vp8lAverage(a, b uint32) uint32 {
+	return (((a ^ b) & 0xfefefefe) >> 1) + (a & b)
+}
+
+func vp8lSelect(l, t, tl uint32) uint32 {
+	pl, pt := 0, 0
+	for shift := 0; shift < 32; shift += 8 {
+		cl, ct, ctl := int(l>>shift&0xff), int(t>>shift&0xff), int(tl>>shift&0xff)
+		p := cl + ct - ctl
+		pl += vp8lAbs(p - cl)
+		pt += vp8lAbs(p - ct)
+	}
+	if pl < pt {
+		return l
+	}
+	return t
+}
+
+// vp8lSub subtracts per channel, modulo 256
+func vp8lSub(a, b uint32) uint32 {
+	ag := 0x00ff00ff + (a & 0xff00ff00) - (b & 0xff00ff00)
+	rb := 0xff00ff00 + (a & 0x00ff00ff) - (b & 0x00ff00ff)
+	return ag&0xff00ff00 | rb&0x00ff00ff
+}
+
+func vp8lResidualCost(r uint32) int {
+	cost := 0
+	for shift := 0; shift < 32; shift += 8 {
+		cost += vp8lAbs(int(int8(r >> shift)))
+	}
+	return cost
+}
+
+func vp8lAbs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// vp8lToken is a literal pixel or a backward reference when length is set
+type vp8lToken struct {
+	pixel    uint32
+	length   int
+	distance int
+}
+
+// vp8lWriteImage writes pixels as an entropy coded image, the main image (level0) has the
+// meta prefix codes bit. The color cache is not used.
+func vp8lWriteImage(bw *vp8lWriter, argb []uint32, width, height int, level0 bool) {
+	bw.write(0, 1)
+	if level0 {
+		bw.write(0, 1)
+	}
+	tokens := vp8lBackwardReferences(argb, width)
+
+	var histograms [5][]int
+	histograms[0] = make([]int, 256+vp8lNumLengthCodes)
+	histograms[1] = make([]int, 256)
+	histograms[2] = make([]int, 256)
+	histograms[3] = make([]int, 256)
+	histograms[4] = make([]int, vp8lNumDistCodes)
+	for _, t := range tokens {
+		if t.length == 0 {
+			histograms[0][t.pixel>>8&0xff]++
+			histograms[1][t.pixel>>16&0xff]++
+			histograms[2][t.pixel&0xff]++
+			histograms[3][t.pixel>>24]++
+			continue
+		}
+		code, _, _ := vp8lPrefix(t.length)
+		histograms[0][256+code]++
+		code, _, _ = vp8lPrefix(vp8lDistanceCode(t.distance, width))
+		histograms[4][code]++
+	}
+	var codes [5]*vp8lCode
+	for i, histogram := range histograms {
+		codes[i] = newVP8LCode(histogram, vp8lMaxCodeLength)
+		vp8lWriteCode(bw, codes[i])
+	}
+
+	for _, t := range tokens {
+		if t.length == 0 {
+			codes[0].write(bw, int(t.pixel>>8&0xff))
+			codes[1].write(bw, int(t.pixel>>16&0xff))
+			codes[2].write(bw, int(t.pixel&0xff))
+			codes[3].write(bw, int(t.pixel>>24))
+			continue
+		}
+		code, n, extra := vp8lPrefix(t.length)
+		codes[0].write(bw, 256+code)
+		bw.write(extra, n)
+		code, n, extra = vp8lPrefix(vp8lDistanceCode(t.distance, width))
+		codes[4].write(bw, code)
+		bw.write(extra, n)
+	}
+}
+
+// vp8lBackwardReferences finds the repeated runs of pixels with hash chains on pixel pairs
+func vp8lBackwardReferences(argb []uint32, width int) []vp8lToken {
+	n := len(argb)
+	head := make([]int32, 1<<vp8lHashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, n)
+	hash := func(i int) uint32 {
+		return (argb[i]*0x1e35a7bd ^ argb[i+1]*0x9e3779b1) >> (32 - vp8lHashBits)
+	}
+	insert := func(i int) {
+		if i+1 < n {
+			h := hash(i)
+			prev[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+	matchLength := func(i, j int) int {
+		l := 0
+		for l < vp8lMaxLength && i+l < n && argb[i+l] == argb[j+l] {
+			l++
+		}
+		return l
+	}
+
+	tokens := make([]vp8lToken, 0, n/2)
+	for i := 0; i < n; {
+		bestLength, bestDistance := 0, 0
+		// the pixel above is a cheap distance code, try it first
+		if i >= width {
+			if l := matchLength(i, i-width); l >= vp8lMinMatch {
+				bestLength, bestDistance = l, width
+			}
+		}
+		if i+1 < n {
+			for j, chain := head[hash(i)], 0; j >= 0 && chain < vp8lMaxChain; j, chain = prev[j], chain+1 {
+				if i-int(j) > vp8lMaxDistance {
+					break
+				}
+				if l := matchLength(i, int(j)); l > bestLength {
+					bestLength, bestDistance = l, i-int(j)
+				}
+			}
+		}
+		if bestLength < vp8lMinMatch {
+			tokens = append(tokens, vp8lToken{pixel: argb[i]})
+			insert(i)
+			i++
+			continue
+		}
+		tokens = append(tokens, vp8lToken{length: bestLength, distance: bestDistance})
+		for k := i; k < i+bestLength; k++ {
+			insert(k)
+		}
+		i += bestLength
+	}
+	return tokens
+}
+
+// vp8lDistanceCode maps a distance to its code: the pixel above and the pixel before
+// have short codes in the distance map, the others are shifted after it
+func vp8lDistanceCode(distance, width int) int {
+	switch distance {
+	case width:
+		return 1
+	case 1:
+		return 2
+	}
+	return distance + 120
+}
+
+// vp8lPrefix splits a value into its prefix code and extra bits
+func vp8lPrefix(value int) (int, uint, uint32) {
+	v := uint32(value - 1)
+	if v < 4 {
+		return int(v), 0, 0
+	}
+	h := uint(bits.Len32(v) - 1)
+	code := int(2*h) + int(v>>(h-1)&1)
+	return code, h - 1, v & (1<<(h-1) - 1)
+}
+
+// vp8lCode is a canonical prefix code
+type vp8lCode struct {
+	lengths []int
+	codes   []uint32
+	// single codes of one symbol take no bits
+	single bool
+}
+
+func newVP8LCode(histogram []int, maxLength int) *vp8lCode {
+	c := &vp8lCode{lengths: vp8lCodeLengths(histogram, maxLength), codes: make([]uint32, len(histogram))}
+	used := 0
+	for _, l := range c.lengths {
+		if l > 0 {
+			used++
+		}
+	}
+	c.single = used == 1
+	// canonical codes, bit reversed as they are read least significant bit first
+	var count [vp8lMaxCodeLength + 2]uint32
+	for _, l := range c.lengths {
+		count[l]++
+	}
+	count[0] = 0
+	var next [vp8lMaxCodeLength + 2]uint32
+	code := uint32(0)
+	for l := 1; l < len(next); l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+	for symbol, l := range c.lengths {
+		if l > 0 {
+			c.codes[symbol] = bits.Reverse32(next[l]) >> (32 - l)
+			next[l]++
+		}
+	}
+	return c
+}
+
+func (c *vp8lCode) write(bw *vp8lWriter, symbol int) {
+	if !c.single {
+		bw.write(c.codes[symbol], uint(c.lengths[symbol]))
+	}
+}
+
+// vp8lCodeLengths are the huffman code lengths of the histogram, limited to maxLength by
+// flattening the counts. An empty histogram has its first symbol as the single code.
+func vp8lCodeLengths(histogram []int, maxLength int) []int {
+	lengths := make([]int, len(histogram))
+	counts := make([]int, len(histogram))
+	used := 0
+	for i, count := range histogram {
+		counts[i] = count
+		if count > 0 {
+			used++
+		}
+	}
+	if used <= 1 {
+		lengths[0] = 1
+		for i, count := range counts {
+			if count > 0 {
+				lengths[0], lengths[i] = 0, 1
+			}
+		}
+		return lengths
+	}
+	for {
+		var nodes []vp8lNode
+		h := &vp8lNodeHeap{nodes: &nodes}
+		for symbol, count := range counts {
+			if count > 0 {
+				nodes = append(nodes, vp8lNode{count: count, symbol: symbol, left: -1, right: -1})
+				h.indexes = append(h.indexes, len(nodes)-1)
+			}
+		}
+		heap.Init(h)
+		for h.Len() > 1 {
+			a, b := heap.Pop(h).(int), heap.Pop(h).(int)
+			nodes = append(nodes, vp8lNode{count: nodes[a].count + nodes[b].count, symbol: -1, left: a, right: b})
+			heap.Push(h, len(nodes)-1)
+		}
+		overflow := false
+		var walk func(node, depth int)
+		walk = func(node, depth int) {
+			if nodes[node].symbol >= 0 {
+				lengths[nodes[node].symbol] = depth
+				overflow = overflow || depth > maxLength
+				return
+			}
+			walk(nodes[node].left, depth+1)
+			walk(nodes[node].right, depth+1)
+		}
+		walk(h.indexes[0], 0)
+		if !overflow {
+			return lengths
+		}
+		for i, count := range counts {
+			if count > 0 {
+				counts[i] = (count + 1) / 2
+			}
+		}
+	}
+}
+
+type vp8lNode struct {
+	count       int
+	symbol      int
+	left, right int
+}
+
+// vp8lNodeHeap orders node indexes by count then symbol, for stable codes
+type vp8lNodeHeap struct {
+	nodes   *[]vp8lNode
+	indexes []int
+}
+
+func (h *vp8lNodeHeap) Len() int { return len(h.indexes) }
+func (h *vp8lNodeHeap) Less(i, j int) bool {
+	a, b := (*h.nodes)[h.indexes[i]], (*h.nodes)[h.indexes[j]]
+	if a.count != b.count {
+		return a.count < b.count
+	}
+	return h.indexes[i] < h.indexes[j]
+}
+func (h *vp8lNodeHeap) Swap(i, j int) { h.indexes[i], h.indexes[j] = h.indexes[j], h.indexes[i] }
+func (h *vp8lNodeHeap) Push(x any)    { h.indexes = append(h.indexes, x.(int)) }
+func (h *vp8lNodeHeap) Pop() any {
+	last := h.indexes[len(h.indexes)-1]
+	h.indexes = h.indexes[:len(h.indexes)-1]
+	return last
+}
+
+// vp8lWriteCode writes the code lengths of a prefix code, themselves prefix coded
+// with runs of zeros (17, 18) and repeats of the previous length (16)
+func vp8lWriteCode(bw *vp8lWriter, c *vp8lCode) {
+	type rle struct {
+		symbol int
+		extra  uint32
+		n      uint
+	}
+	var symbols []rle
+	lengths := c.lengths
+	for i := 0; i < len(lengths); {
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == lengths[i] {
+			run++
+		}
+		i += run
+		if lengths[i-run] == 0 {
+			for run >= 11 {
+				n := run
+				if n > 138 {
+					n = 138
+				}
+				symbols = append(symbols, rle{18, uint32(n - 11), 7})
+				run -= n
+			}
+			if run >= 3 {
+				symbols = append(symbols, rle{17, uint32(run - 3), 3})
+				run = 0
+			}
+			for ; run > 0; run-- {
+				symbols = append(symbols, rle{symbol: 0})
+			}
+			continue
+		}
+		symbols = append(symbols, rle{symbol: lengths[i-run]})
+		run--
+		for run >= 3 {
+			n := run
+			if n > 6 {
+				n = 6
+			}
+			symbols = append(symbols, rle{16, uint32(n - 3), 2})
+			run -= n
+		}
+		for ; run > 0; run-- {
+			symbols = append(symbols, rle{symbol: lengths[i-run]})
+		}
+	}
+
+	histogram := make([]int, len(vp8lCodeLengthOrder))
+	for _, s := range symbols {
+		histogram[s.symbol]++
+	}
+	lengthCode := newVP8LCode(histogram, vp8lMaxCodeLengthC)
+	count := len(vp8lCodeLengthOrder)
+	for count > 4 && lengthCode.lengths[vp8lCodeLengthOrder[count-1]] == 0 {
+		count--
+	}
+	// not a simple code
+	bw.write(0, 1)
+	bw.write(uint32(count-4), 4)
+	for _, symbol := range vp8lCodeLengthOrder[:count] {
+		bw.write(uint32(lengthCode.lengths[symbol]), 3)
+	}
+	// all the symbols are written, no max symbol
+	bw.write(0, 1)
+	for _, s := range symbols {
+		lengthCode.write(bw, s.symbol)
+		bw.write(s.extra, s.n)
+	}
+}